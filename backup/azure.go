@@ -0,0 +1,96 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/pkg/errors"
+)
+
+// AzureTarget stores a backup as blobs under Prefix in an Azure Blob
+// Storage container.
+type AzureTarget struct {
+	Container string
+	Prefix    string
+
+	containerURL azblob.ContainerURL
+}
+
+// NewAzureTarget returns an AzureTarget for container, authenticating
+// with the account name/key in the AZURE_STORAGE_ACCOUNT/
+// AZURE_STORAGE_KEY environment variables (the convention azblob's own
+// tooling uses).
+func NewAzureTarget(container, prefix string) (*AzureTarget, error) {
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	key := os.Getenv("AZURE_STORAGE_KEY")
+	cred, err := azblob.NewSharedKeyCredential(account, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating Azure credential")
+	}
+
+	u, err := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s", account, container))
+	if err != nil {
+		return nil, errors.Wrap(err, "building container URL")
+	}
+
+	pipeline := azblob.NewPipeline(cred, azblob.PipelineOptions{})
+	return &AzureTarget{
+		Container:    container,
+		Prefix:       prefix,
+		containerURL: azblob.NewContainerURL(*u, pipeline),
+	}, nil
+}
+
+func (t *AzureTarget) blobURL(key string) azblob.BlockBlobURL {
+	return t.containerURL.NewBlockBlobURL(t.Prefix + "/" + key)
+}
+
+// Put implements Target.
+func (t *AzureTarget) Put(key string, src io.Reader) error {
+	_, err := azblob.UploadStreamToBlockBlob(context.Background(), src, t.blobURL(key), azblob.UploadStreamToBlockBlobOptions{})
+	return errors.Wrapf(err, "uploading %s", key)
+}
+
+// Get implements Target.
+func (t *AzureTarget) Get(key string) (io.ReadCloser, error) {
+	resp, err := t.blobURL(key).Download(context.Background(), 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %s", key)
+	}
+	return resp.Body(azblob.RetryReaderOptions{}), nil
+}
+
+// List implements Target.
+func (t *AzureTarget) List() ([]string, error) {
+	var keys []string
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := t.containerURL.ListBlobsFlatSegment(context.Background(), marker, azblob.ListBlobsSegmentOptions{Prefix: t.Prefix})
+		if err != nil {
+			return nil, errors.Wrap(err, "listing blobs")
+		}
+		for _, blob := range resp.Segment.BlobItems {
+			keys = append(keys, strings.TrimPrefix(blob.Name, t.Prefix+"/"))
+		}
+		marker = resp.NextMarker
+	}
+	return keys, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
+)
+
+// GCSTarget stores a backup as objects under Prefix in a Google Cloud
+// Storage bucket.
+type GCSTarget struct {
+	Bucket string
+	Prefix string
+
+	client *storage.Client
+}
+
+// NewGCSTarget returns a GCSTarget using the default Google Cloud
+// credentials (environment, metadata server, or gcloud config).
+func NewGCSTarget(bucket, prefix string) (*GCSTarget, error) {
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating GCS client")
+	}
+	return &GCSTarget{Bucket: bucket, Prefix: prefix, client: client}, nil
+}
+
+func (t *GCSTarget) objectName(key string) string {
+	return t.Prefix + "/" + key
+}
+
+// Put implements Target.
+func (t *GCSTarget) Put(key string, src io.Reader) error {
+	ctx := context.Background()
+	w := t.client.Bucket(t.Bucket).Object(t.objectName(key)).NewWriter(ctx)
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close() //nolint:errcheck
+		return errors.Wrapf(err, "uploading %s", key)
+	}
+	return errors.Wrapf(w.Close(), "finalizing upload of %s", key)
+}
+
+// Get implements Target.
+func (t *GCSTarget) Get(key string) (io.ReadCloser, error) {
+	r, err := t.client.Bucket(t.Bucket).Object(t.objectName(key)).NewReader(context.Background())
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %s", key)
+	}
+	return r, nil
+}
+
+// List implements Target.
+func (t *GCSTarget) List() ([]string, error) {
+	it := t.client.Bucket(t.Bucket).Objects(context.Background(), &storage.Query{Prefix: t.Prefix})
+
+	var keys []string
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "listing objects")
+		}
+		keys = append(keys, strings.TrimPrefix(attrs.Name, t.Prefix+"/"))
+	}
+	return keys, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// LocalTarget stores a backup as files under Dir.
+type LocalTarget struct {
+	Dir string
+}
+
+// Put implements Target.
+func (t *LocalTarget) Put(key string, src io.Reader) error {
+	dst := filepath.Join(t.Dir, key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return errors.Wrapf(err, "creating directory for %s", key)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", dst)
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, src)
+	return errors.Wrapf(err, "writing %s", key)
+}
+
+// Get implements Target.
+func (t *LocalTarget) Get(key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(t.Dir, key))
+	return f, errors.Wrapf(err, "opening %s", key)
+}
+
+// List implements Target.
+func (t *LocalTarget) List() ([]string, error) {
+	var keys []string
+	err := filepath.Walk(t.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(t.Dir, path)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, rel)
+		return nil
+	})
+	return keys, errors.Wrap(err, "listing local backup target")
+}
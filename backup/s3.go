@@ -0,0 +1,94 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+// S3Target stores a backup as objects under Prefix in an S3 bucket.
+type S3Target struct {
+	Bucket string
+	Prefix string
+
+	client *s3.S3
+}
+
+// NewS3Target returns an S3Target using the default AWS session/region
+// configuration (environment, shared config, or instance profile).
+func NewS3Target(bucket, prefix string) (*S3Target, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating AWS session")
+	}
+	return &S3Target{Bucket: bucket, Prefix: prefix, client: s3.New(sess)}, nil
+}
+
+func (t *S3Target) objectKey(key string) string {
+	return t.Prefix + "/" + key
+}
+
+// Put implements Target.
+func (t *S3Target) Put(key string, src io.Reader) error {
+	buf, err := ioutil.ReadAll(src)
+	if err != nil {
+		return errors.Wrapf(err, "reading %s", key)
+	}
+
+	_, err = t.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(t.Bucket),
+		Key:    aws.String(t.objectKey(key)),
+		Body:   bytes.NewReader(buf),
+	})
+	return errors.Wrapf(err, "uploading %s", key)
+}
+
+// Get implements Target.
+func (t *S3Target) Get(key string) (io.ReadCloser, error) {
+	out, err := t.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(t.Bucket),
+		Key:    aws.String(t.objectKey(key)),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetching %s", key)
+	}
+	return out.Body, nil
+}
+
+// List implements Target.
+func (t *S3Target) List() ([]string, error) {
+	var keys []string
+	err := t.client.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(t.Bucket),
+		Prefix: aws.String(t.Prefix),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.StringValue(obj.Key), t.Prefix+"/"))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing objects")
+	}
+	return keys, nil
+}
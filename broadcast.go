@@ -0,0 +1,28 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+// BroadcastReceiver handles cluster-wide broadcast messages (schema
+// changes, resize events) delivered over the gossip transport.
+type BroadcastReceiver interface {
+	Start(*Server) error
+}
+
+// NopBroadcastReceiver is a BroadcastReceiver that does nothing, used as
+// the default until a node joins a cluster.
+type NopBroadcastReceiver struct{}
+
+// Start implements BroadcastReceiver.
+func (NopBroadcastReceiver) Start(*Server) error { return nil }
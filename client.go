@@ -0,0 +1,75 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// InternalHTTPClient issues node-to-node administrative requests (schema,
+// cluster status, resize operations) against a specific host, separately
+// from the public PQL query API.
+type InternalHTTPClient struct {
+	hostport string
+	client   *http.Client
+}
+
+// NewInternalHTTPClient returns a client that talks to the node at
+// hostport using client for transport.
+func NewInternalHTTPClient(hostport string, client *http.Client) (*InternalHTTPClient, error) {
+	return &InternalHTTPClient{hostport: hostport, client: client}, nil
+}
+
+// Pause tells the remote node to stop accepting requests, the same way
+// Server.Pause does locally.
+func (c *InternalHTTPClient) Pause() error {
+	return c.post("/internal/pause")
+}
+
+// Resume reverses Pause.
+func (c *InternalHTTPClient) Resume() error {
+	return c.post("/internal/resume")
+}
+
+func (c *InternalHTTPClient) post(path string) error {
+	scheme := "http"
+	if t, ok := c.client.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		scheme = "https"
+	}
+	resp, err := c.client.Post(fmt.Sprintf("%s://%s%s", scheme, c.hostport, path), "", nil)
+	if err != nil {
+		return errors.Wrapf(err, "posting to %s%s", c.hostport, path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.Errorf("%s%s: unexpected status %d", c.hostport, path, resp.StatusCode)
+	}
+	return nil
+}
+
+// GetHTTPClient returns an *http.Client that dials with tlsConfig, or
+// http.DefaultClient when tlsConfig is nil.
+func GetHTTPClient(tlsConfig *tls.Config) *http.Client {
+	if tlsConfig == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+// Node represents a single member of a cluster, identified by its URI.
+type Node struct {
+	URI URI
+}
+
+// Cluster represents this node's view of cluster membership and
+// coordinator election.
+type Cluster struct {
+	Coordinator URI
+	Static      bool
+	Nodes       []Node
+}
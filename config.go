@@ -0,0 +1,116 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import "time"
+
+// Config represents the configuration for a Pilosa server instance.
+type Config struct {
+	DataDir string `toml:"data-dir"`
+	Bind    string `toml:"bind"`
+
+	// GRPCBind is the address the gRPC API listens on, e.g.
+	// localhost:20101. Empty disables the gRPC listener.
+	GRPCBind string `toml:"grpc-bind"`
+
+	Cluster   ClusterConfig   `toml:"cluster"`
+	Gossip    GossipConfig    `toml:"gossip"`
+	Discovery DiscoveryConfig `toml:"discovery"`
+	Metric    MetricConfig    `toml:"metric"`
+	TLS       TLSConfig       `toml:"tls"`
+	Limits    LimitsConfig    `toml:"limits"`
+}
+
+// ClusterConfig holds configuration for cluster membership.
+type ClusterConfig struct {
+	Disabled bool `toml:"disabled"`
+}
+
+// GossipConfig holds configuration for the gossip transport used for
+// cluster membership and broadcast.
+type GossipConfig struct {
+	Seeds []string `toml:"seeds"`
+}
+
+// DiscoveryConfig selects the service-discovery backend a node uses to
+// find its peers and the cluster coordinator, instead of listing peer
+// addresses directly in Gossip.Seeds.
+type DiscoveryConfig struct {
+	// Backend is one of "consul", "etcd", "kubernetes", or "" (disabled,
+	// use Gossip.Seeds directly).
+	Backend string `toml:"backend"`
+
+	// Address is backend-specific: a Consul or etcd agent address for
+	// "consul"/"etcd", or "namespace/service/lease" for "kubernetes".
+	Address string `toml:"address"`
+}
+
+// MetricConfig holds configuration for metrics/diagnostics reporting.
+type MetricConfig struct {
+	Diagnostics bool `toml:"diagnostics"`
+
+	// Namespace prefixes every Prometheus series, e.g. "pilosa" yields
+	// pilosa_query_duration_seconds.
+	Namespace string `toml:"namespace"`
+
+	// PushGatewayAddr, when set, adds periodic pushing to a Prometheus
+	// Pushgateway at this address; the pull-mode /metrics endpoint is
+	// served either way.
+	PushGatewayAddr string        `toml:"push-gateway"`
+	PushInterval    time.Duration `toml:"push-interval"`
+}
+
+// LimitsConfig holds configuration for the rate limiter and circuit
+// breaker middleware guarding the query/import endpoints, so a single
+// runaway client can't stall the whole node.
+type LimitsConfig struct {
+	// QueryQPS and ImportBytesPerSec are the default token-bucket rates
+	// for the /index/*/query and import endpoints, respectively. Zero
+	// means unlimited.
+	QueryQPS          float64 `toml:"query-qps"`
+	ImportBytesPerSec float64 `toml:"import-bytes-per-sec"`
+
+	// BreakerErrorRatio opens the circuit breaker for an endpoint once
+	// its error ratio exceeds this value, provided at least
+	// BreakerMinRequests have been observed. The ratio counts every
+	// request since the breaker last closed; it is not a rolling window.
+	// The breaker stays open for BreakerCooldown before allowing requests
+	// through again.
+	BreakerErrorRatio  float64       `toml:"breaker-error-ratio"`
+	BreakerMinRequests int           `toml:"breaker-min-requests"`
+	BreakerCooldown    time.Duration `toml:"breaker-cooldown"`
+
+	// Endpoints overrides QueryQPS on a per-endpoint basis, keyed by
+	// request path (e.g. "/index/foo/query"). Set at runtime via
+	// Server.SetLimit for tests that need to throttle a single endpoint.
+	Endpoints map[string]float64 `toml:"endpoints"`
+}
+
+// NewConfig returns a Config with default values applied.
+func NewConfig() *Config {
+	return &Config{
+		Bind:     "http://localhost:10101",
+		GRPCBind: "localhost:20101",
+		Metric: MetricConfig{
+			Namespace:    "pilosa",
+			PushInterval: 10 * time.Second,
+		},
+		Limits: LimitsConfig{
+			BreakerErrorRatio:  0.5,
+			BreakerMinRequests: 20,
+			BreakerCooldown:    30 * time.Second,
+		},
+	}
+}
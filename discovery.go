@@ -0,0 +1,62 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+// Discovery abstracts the service-discovery backend a node uses to find
+// its cluster peers and the current coordinator at bootstrap, instead of
+// being handed gossipSeeds/coordinator directly.
+type Discovery interface {
+	// Register announces n as a member of the cluster.
+	Register(n Node) error
+
+	// Seeds returns the gossip addresses of existing cluster members, to
+	// be used as join targets.
+	Seeds() ([]string, error)
+
+	// WatchCoordinator returns a channel that receives the URI of the
+	// elected coordinator, and again whenever that election changes.
+	WatchCoordinator() (<-chan URI, error)
+}
+
+// StaticDiscovery implements Discovery from a fixed list of seed
+// addresses and a fixed coordinator. It reproduces the original
+// "pass seeds and coordinator in explicitly" behavior behind the
+// Discovery interface, so code that doesn't need a real backend (or
+// fake discovery in tests) doesn't have to special-case itself.
+type StaticDiscovery struct {
+	SeedAddrs   []string
+	Coordinator URI
+
+	Registered []Node
+}
+
+// Register implements Discovery.
+func (d *StaticDiscovery) Register(n Node) error {
+	d.Registered = append(d.Registered, n)
+	return nil
+}
+
+// Seeds implements Discovery.
+func (d *StaticDiscovery) Seeds() ([]string, error) {
+	return d.SeedAddrs, nil
+}
+
+// WatchCoordinator implements Discovery. Since the coordinator is fixed,
+// it sends exactly once on a buffered channel.
+func (d *StaticDiscovery) WatchCoordinator() (<-chan URI, error) {
+	ch := make(chan URI, 1)
+	ch <- d.Coordinator
+	return ch, nil
+}
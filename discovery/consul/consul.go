@@ -0,0 +1,213 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consul implements pilosa.Discovery on top of Consul's service
+// catalog and session/lock APIs, so a cluster can bootstrap without
+// operators pre-wiring peer addresses.
+package consul
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/pilosa/pilosa"
+	"github.com/pkg/errors"
+)
+
+const (
+	// serviceName is the Consul service name nodes register themselves
+	// under and discover peers through.
+	serviceName = "pilosa"
+
+	// coordinatorKey is the KV path used for coordinator election via a
+	// Consul session lock.
+	coordinatorKey = "pilosa/coordinator"
+
+	// sessionTTL bounds how long a coordinator can go unresponsive before
+	// Consul releases its lock and lets another node win the election.
+	sessionTTL = 15 * time.Second
+
+	// watchTimeout bounds each blocking query watching coordinatorKey, so
+	// a node that lost the election still wakes up periodically even if
+	// Consul never reports a change (e.g. it missed one).
+	watchTimeout = time.Minute
+)
+
+// Discovery implements pilosa.Discovery backed by a Consul agent.
+type Discovery struct {
+	client *consulapi.Client
+	self   pilosa.URI
+
+	// watchIndex is the Consul index of coordinatorKey last reported by
+	// watchForChange, so each later call blocks until the key moves past it.
+	watchIndex uint64
+}
+
+// New returns a Discovery that talks to the Consul agent at addr (e.g.
+// "127.0.0.1:8500").
+func New(addr string) (*Discovery, error) {
+	cfg := consulapi.DefaultConfig()
+	cfg.Address = addr
+
+	client, err := consulapi.NewClient(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating consul client")
+	}
+
+	return &Discovery{client: client}, nil
+}
+
+// Register implements pilosa.Discovery by registering n as a Consul
+// service instance.
+func (d *Discovery) Register(n pilosa.Node) error {
+	d.self = n.URI
+
+	reg := &consulapi.AgentServiceRegistration{
+		ID:      n.URI.String(),
+		Name:    serviceName,
+		Address: n.URI.Host,
+		Port:    int(n.URI.Port),
+	}
+	return errors.Wrap(d.client.Agent().ServiceRegister(reg), "registering with consul")
+}
+
+// Seeds implements pilosa.Discovery by listing the healthy pilosa service
+// instances known to Consul, this node's own registration included.
+func (d *Discovery) Seeds() ([]string, error) {
+	entries, _, err := d.client.Health().Service(serviceName, "", true, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying consul service health")
+	}
+
+	seeds := make([]string, 0, len(entries))
+	for _, e := range entries {
+		seeds = append(seeds, net.JoinHostPort(e.Service.Address, strconv.Itoa(e.Service.Port)))
+	}
+	return seeds, nil
+}
+
+// WatchCoordinator implements pilosa.Discovery by competing for a Consul
+// session lock on coordinatorKey: whichever node acquires it is the
+// coordinator, and it announces itself on the returned channel. Every
+// other node first reports the current holder, then blocks on the key via
+// a Consul blocking query (WaitIndex, not polling) until the lock changes
+// hands, reports the new winner and re-enters the campaign.
+func (d *Discovery) WatchCoordinator() (<-chan pilosa.URI, error) {
+	ch := make(chan pilosa.URI, 1)
+	go d.campaign(ch)
+	return ch, nil
+}
+
+func (d *Discovery) campaign(ch chan<- pilosa.URI) {
+	for {
+		session, _, err := d.client.Session().Create(&consulapi.SessionEntry{
+			Behavior: consulapi.SessionBehaviorRelease,
+			TTL:      sessionTTL.String(),
+		}, nil)
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		acquired, _, err := d.client.KV().Acquire(&consulapi.KVPair{
+			Key:     coordinatorKey,
+			Value:   []byte(d.self.String()),
+			Session: session,
+		}, nil)
+		if err != nil {
+			d.client.Session().Destroy(session, nil) //nolint:errcheck // best-effort cleanup before retrying
+			time.Sleep(time.Second)
+			continue
+		}
+		if acquired {
+			ch <- d.self
+			d.holdUntilLost(session)
+			d.client.Session().Destroy(session, nil) //nolint:errcheck // session is already gone or about to be
+			continue
+		}
+		d.client.Session().Destroy(session, nil) //nolint:errcheck // unused; we lost the Acquire race
+
+		if uri, ok := d.watchForChange(); ok {
+			ch <- uri
+		}
+	}
+}
+
+// holdUntilLost renews session at a fraction of its TTL until a renewal
+// fails, which means Consul released the lock (the node went
+// unresponsive, or was network-partitioned from the agent) and someone
+// else may now win the election.
+func (d *Discovery) holdUntilLost(session string) {
+	ticker := time.NewTicker(sessionTTL / 3)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, _, err := d.client.Session().Renew(session, nil); err != nil {
+			return
+		}
+	}
+}
+
+// watchForChange blocks until coordinatorKey changes from the state the
+// previous call reported (or watchTimeout elapses with no change, in which
+// case it just retries), then returns the coordinator it now names; the
+// first call returns the current holder at once. It returns ok=false when
+// the key has no holder at all (missing, or its lock released), so the
+// caller goes back to campaigning for it itself rather than watching a
+// lock nobody holds.
+func (d *Discovery) watchForChange() (pilosa.URI, bool) {
+	for {
+		pair, meta, err := d.client.KV().Get(coordinatorKey, &consulapi.QueryOptions{
+			WaitIndex: d.watchIndex,
+			WaitTime:  watchTimeout,
+		})
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+		if pair == nil || pair.Session == "" {
+			return pilosa.URI{}, false
+		}
+		if meta.LastIndex == d.watchIndex {
+			continue // blocking query timed out without a change
+		}
+		d.watchIndex = meta.LastIndex
+
+		uri, err := parseURI(string(pair.Value))
+		if err != nil {
+			continue
+		}
+		return uri, true
+	}
+}
+
+func parseURI(s string) (pilosa.URI, error) {
+	parts := strings.SplitN(s, "://", 2)
+	if len(parts) != 2 {
+		return pilosa.URI{}, errors.Errorf("invalid coordinator URI %q", s)
+	}
+	scheme, hostport := parts[0], parts[1]
+
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return pilosa.URI{}, errors.Wrapf(err, "invalid coordinator URI %q", s)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return pilosa.URI{}, errors.Wrapf(err, "invalid coordinator URI %q", s)
+	}
+	return pilosa.URI{Scheme: scheme, Host: host, Port: uint16(port)}, nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package etcd implements pilosa.Discovery on top of etcd's key space and
+// its concurrency package, which already provides session-lease-backed
+// leader election so this doesn't have to reimplement the campaign/renew
+// loop that discovery/consul hand-rolls on top of raw KV operations.
+package etcd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pilosa/pilosa"
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/clientv3"
+	"go.etcd.io/etcd/clientv3/concurrency"
+)
+
+const (
+	// nodesPrefix is the key prefix nodes register themselves under, keyed
+	// by their URI so Seeds can list them back out.
+	nodesPrefix = "/pilosa/nodes/"
+
+	// electionPrefix is the etcd concurrency election all nodes campaign
+	// in for the coordinator role.
+	electionPrefix = "/pilosa/coordinator/"
+
+	// leaseTTL bounds how long a node's registration and campaign survive
+	// after it stops renewing its session (e.g. it crashed).
+	leaseTTL = 15 * time.Second
+)
+
+// Discovery implements pilosa.Discovery backed by an etcd cluster.
+type Discovery struct {
+	client *clientv3.Client
+	self   pilosa.URI
+}
+
+// New returns a Discovery that talks to the etcd cluster at endpoints (a
+// comma-separated list of "host:port" addresses).
+func New(endpoints string) (*Discovery, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "creating etcd client")
+	}
+	return &Discovery{client: client}, nil
+}
+
+// Register implements pilosa.Discovery by putting n's URI under
+// nodesPrefix, attached to a lease this node keeps alive for as long as
+// it's running, so it disappears if this node crashes.
+func (d *Discovery) Register(n pilosa.Node) error {
+	d.self = n.URI
+
+	lease, err := d.client.Grant(context.Background(), int64(leaseTTL.Seconds()))
+	if err != nil {
+		return errors.Wrap(err, "granting etcd lease")
+	}
+
+	_, err = d.client.Put(context.Background(), nodesPrefix+n.URI.String(), n.URI.String(), clientv3.WithLease(lease.ID))
+	if err != nil {
+		return errors.Wrap(err, "registering with etcd")
+	}
+
+	keepAlive, err := d.client.KeepAlive(context.Background(), lease.ID)
+	if err != nil {
+		return errors.Wrap(err, "keeping etcd lease alive")
+	}
+	go func() {
+		for range keepAlive {
+			// drain responses for the process lifetime; etcd stops
+			// renewing (and the registration expires) once this exits.
+		}
+	}()
+
+	return nil
+}
+
+// Seeds implements pilosa.Discovery by listing the URIs registered under
+// nodesPrefix.
+func (d *Discovery) Seeds() ([]string, error) {
+	resp, err := d.client.Get(context.Background(), nodesPrefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, errors.Wrap(err, "listing etcd nodes")
+	}
+
+	seeds := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		seeds = append(seeds, string(kv.Value))
+	}
+	return seeds, nil
+}
+
+// WatchCoordinator implements pilosa.Discovery using etcd's concurrency
+// package: every node campaigns in the same election, and whoever holds it
+// is reported on the returned channel, along with every subsequent change
+// observed. concurrency.Session/Election already handle the lease-renewal
+// and blocking-watch work that discovery/consul does by hand against the
+// raw KV API.
+func (d *Discovery) WatchCoordinator() (<-chan pilosa.URI, error) {
+	ch := make(chan pilosa.URI, 1)
+	go d.campaign(ch)
+	return ch, nil
+}
+
+func (d *Discovery) campaign(ch chan<- pilosa.URI) {
+	for {
+		session, err := concurrency.NewSession(d.client, concurrency.WithTTL(int(leaseTTL.Seconds())))
+		if err != nil {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		election := concurrency.NewElection(session, electionPrefix)
+		go d.announceLeader(election, ch)
+
+		if err := election.Campaign(context.Background(), d.self.String()); err != nil {
+			session.Close() //nolint:errcheck // session is being discarded anyway
+			time.Sleep(time.Second)
+			continue
+		}
+
+		<-session.Done() // blocks until this node's session/lease is lost
+	}
+}
+
+// announceLeader watches election and forwards every observed leader
+// value onto ch, so nodes that lost the campaign still learn who won
+// (and when that changes) without polling.
+func (d *Discovery) announceLeader(election *concurrency.Election, ch chan<- pilosa.URI) {
+	for resp := range election.Observe(context.Background()) {
+		if len(resp.Kvs) == 0 {
+			continue
+		}
+		uri, err := parseURI(string(resp.Kvs[0].Value))
+		if err != nil {
+			continue
+		}
+		ch <- uri
+	}
+}
+
+func parseURI(s string) (pilosa.URI, error) {
+	parts := strings.SplitN(s, "://", 2)
+	if len(parts) != 2 {
+		return pilosa.URI{}, errors.Errorf("invalid coordinator URI %q", s)
+	}
+	scheme, hostport := parts[0], parts[1]
+
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return pilosa.URI{}, errors.Wrapf(err, "invalid coordinator URI %q", s)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return pilosa.URI{}, errors.Wrapf(err, "invalid coordinator URI %q", s)
+	}
+	return pilosa.URI{Scheme: scheme, Host: host, Port: uint16(port)}, nil
+}
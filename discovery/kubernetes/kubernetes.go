@@ -0,0 +1,191 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kubernetes implements pilosa.Discovery on top of a headless
+// Kubernetes Service (for peer discovery via its Endpoints) and the
+// client-go leaderelection package (for coordinator election via a
+// Lease object), rather than anything pilosa-specific: both pieces are
+// the standard way a Kubernetes-native app finds its peers and elects a
+// leader.
+package kubernetes
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pilosa/pilosa"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// Discovery implements pilosa.Discovery backed by a Kubernetes Service
+// (for peer discovery) and a Lease (for coordinator election).
+type Discovery struct {
+	client    kubernetes.Interface
+	namespace string
+	service   string
+	lease     string
+	self      pilosa.URI
+}
+
+// New returns a Discovery using the in-cluster config when running as a
+// pod, falling back to the local kubeconfig otherwise (e.g. for
+// out-of-cluster testing). addr is "namespace/service/lease": service
+// names the headless Service whose Endpoints are the gossip seeds, and
+// lease names the Lease object nodes campaign for as coordinator.
+func New(addr string) (*Discovery, error) {
+	namespace, service, lease, err := splitAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		kubeconfig := clientcmd.NewDefaultClientConfigLoadingRules().GetDefaultFilename()
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "loading kubernetes config")
+		}
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating kubernetes client")
+	}
+
+	return &Discovery{client: clientset, namespace: namespace, service: service, lease: lease}, nil
+}
+
+// Register implements pilosa.Discovery. Kubernetes already adds this
+// pod's address to the Service's Endpoints once its readiness probe
+// passes, so there's nothing to do beyond remembering our own URI for
+// the leader-election campaign.
+func (d *Discovery) Register(n pilosa.Node) error {
+	d.self = n.URI
+	return nil
+}
+
+// Seeds implements pilosa.Discovery by listing the addresses in the
+// Service's Endpoints object.
+func (d *Discovery) Seeds() ([]string, error) {
+	endpoints, err := d.client.CoreV1().Endpoints(d.namespace).Get(context.Background(), d.service, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "listing kubernetes endpoints")
+	}
+
+	var seeds []string
+	for _, subset := range endpoints.Subsets {
+		port := gossipPort(subset.Ports)
+		for _, addr := range subset.Addresses {
+			seeds = append(seeds, net.JoinHostPort(addr.IP, strconv.Itoa(port)))
+		}
+	}
+	return seeds, nil
+}
+
+// WatchCoordinator implements pilosa.Discovery using client-go's
+// leaderelection package against a Lease object: whichever node holds the
+// lease is the coordinator, and every change (including losing it) is
+// reported on the returned channel.
+func (d *Discovery) WatchCoordinator() (<-chan pilosa.URI, error) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{Name: d.lease, Namespace: d.namespace},
+		Client:    d.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: d.self.String(),
+		},
+	}
+
+	ch := make(chan pilosa.URI, 1)
+	go d.campaign(lock, ch)
+	return ch, nil
+}
+
+func (d *Discovery) campaign(lock *resourcelock.LeaseLock, ch chan<- pilosa.URI) {
+	for {
+		leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+			Lock:          lock,
+			LeaseDuration: leaseDuration,
+			RenewDeadline: renewDeadline,
+			RetryPeriod:   retryPeriod,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(context.Context) { ch <- d.self },
+				// Losing the lease is reported through OnNewLeader once
+				// another node takes it over.
+				OnStoppedLeading: func() {},
+				OnNewLeader: func(identity string) {
+					if uri, err := parseURI(identity); err == nil {
+						ch <- uri
+					}
+				},
+			},
+		})
+	}
+}
+
+// gossipPort picks the port named "gossip" from ports, falling back to
+// the first port if none is named (a Service with a single port doesn't
+// have to name it).
+func gossipPort(ports []corev1.EndpointPort) int {
+	if len(ports) == 0 {
+		return 0
+	}
+	for _, p := range ports {
+		if p.Name == "gossip" {
+			return int(p.Port)
+		}
+	}
+	return int(ports[0].Port)
+}
+
+func splitAddr(addr string) (namespace, service, lease string, err error) {
+	parts := strings.SplitN(addr, "/", 3)
+	if len(parts) != 3 {
+		return "", "", "", errors.Errorf("kubernetes discovery address must be namespace/service/lease, got %q", addr)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+func parseURI(s string) (pilosa.URI, error) {
+	parts := strings.SplitN(s, "://", 2)
+	if len(parts) != 2 {
+		return pilosa.URI{}, errors.Errorf("invalid coordinator URI %q", s)
+	}
+	scheme, hostport := parts[0], parts[1]
+
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return pilosa.URI{}, errors.Wrapf(err, "invalid coordinator URI %q", s)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return pilosa.URI{}, errors.Wrapf(err, "invalid coordinator URI %q", s)
+	}
+	return pilosa.URI{Scheme: scheme, Host: host, Port: uint16(port)}, nil
+}
@@ -0,0 +1,239 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gossip implements the packet transport used for cluster
+// membership and broadcast.
+package gossip
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pilosa/pilosa"
+	"github.com/pkg/errors"
+)
+
+// Transport is a gossip packet transport bound to a local UDP address. Its
+// ReadFrom/WriteTo honor a per-peer allow/deny matrix set via
+// BlockPeer/AllowPeer, and an overall Pause, so that chaos tests can
+// simulate network partitions and a SIGSTOP-equivalent pause of incoming
+// gossip traffic.
+type Transport struct {
+	URI  pilosa.URI
+	conn *net.UDPConn
+
+	// aead, when non-nil, seals every outgoing packet and opens every
+	// incoming one. A real TLS handshake doesn't apply here: gossip
+	// packets are individual UDP datagrams, not a byte stream, so there's
+	// no connection to run the handshake over (that's why DTLS exists as
+	// a distinct protocol, which the standard library doesn't implement).
+	// Instead this derives a cluster-wide symmetric key from the shared
+	// CA certificate and uses it for AES-GCM authenticated encryption,
+	// the same approach memberlist itself uses for gossip encryption
+	// (a pre-shared keyring, independent of any per-connection TLS).
+	aead cipher.AEAD
+
+	mu      sync.RWMutex
+	blocked map[string]bool
+
+	paused int32
+
+	// OnChurn, when set, is called every time BlockPeer/AllowPeer changes
+	// a peer's reachability - this transport's only notion of cluster
+	// membership changing, there being no full memberlist delegate wired
+	// in here. The caller (typically Server.Metrics.GossipChurn.Inc) uses
+	// it to track churn.
+	OnChurn func()
+}
+
+// NewTransport binds a plaintext gossip transport on host:bindPort (0
+// picks a random port).
+func NewTransport(host string, bindPort int) (*Transport, error) {
+	return newTransport(host, bindPort, nil)
+}
+
+// NewTLSTransport binds a gossip transport on host:bindPort that encrypts
+// and authenticates every packet using a key derived from caCert, the PEM
+// bytes of the CA certificate shared by every node in the cluster (the
+// same CA that authenticates the HTTP listener). Any two nodes configured
+// with the same CA derive the same key and can talk to each other;
+// nodes with a different (or no) CA cannot decrypt or forge packets.
+func NewTLSTransport(host string, bindPort int, caCert []byte) (*Transport, error) {
+	if len(caCert) == 0 {
+		return nil, errors.New("gossip: TLS transport requires a non-empty CA certificate")
+	}
+
+	key := sha256.Sum256(caCert)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing gossip cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "initializing gossip AEAD")
+	}
+
+	return newTransport(host, bindPort, aead)
+}
+
+func newTransport(host string, bindPort int, aead cipher.AEAD) (*Transport, error) {
+	addr := &net.UDPAddr{IP: net.ParseIP(host), Port: bindPort}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "binding gossip transport")
+	}
+
+	local := conn.LocalAddr().(*net.UDPAddr)
+	scheme := "gossip"
+	if aead != nil {
+		scheme = "gossips"
+	}
+
+	return &Transport{
+		URI:     pilosa.URI{Scheme: scheme, Host: host, Port: uint16(local.Port)},
+		conn:    conn,
+		aead:    aead,
+		blocked: make(map[string]bool),
+	}, nil
+}
+
+// BlockPeer drops packets to and from the peer at addr, simulating a
+// network partition between this node and addr.
+func (t *Transport) BlockPeer(addr string) {
+	t.mu.Lock()
+	t.blocked[addr] = true
+	t.mu.Unlock()
+	t.notifyChurn()
+}
+
+// AllowPeer reverses a prior BlockPeer, letting addr communicate again.
+func (t *Transport) AllowPeer(addr string) {
+	t.mu.Lock()
+	delete(t.blocked, addr)
+	t.mu.Unlock()
+	t.notifyChurn()
+}
+
+func (t *Transport) notifyChurn() {
+	if t.OnChurn != nil {
+		t.OnChurn()
+	}
+}
+
+// Blocked reports whether packets to/from addr are currently being
+// dropped, either because addr was blocked individually or the transport
+// as a whole is paused.
+func (t *Transport) Blocked(addr string) bool {
+	if atomic.LoadInt32(&t.paused) == 1 {
+		return true
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.blocked[addr]
+}
+
+// Pause drops all incoming and outgoing packets, regardless of peer,
+// approximating a SIGSTOP of the transport.
+func (t *Transport) Pause() {
+	atomic.StoreInt32(&t.paused, 1)
+}
+
+// Resume reverses Pause.
+func (t *Transport) Resume() {
+	atomic.StoreInt32(&t.paused, 0)
+}
+
+// seal returns a new buffer holding a random nonce followed by b encrypted
+// under it when t.aead is set, returning b unchanged otherwise.
+func (t *Transport) seal(b []byte) ([]byte, error) {
+	if t.aead == nil {
+		return b, nil
+	}
+	nonce := make([]byte, t.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "generating nonce")
+	}
+	return t.aead.Seal(nonce, nonce, b, nil), nil
+}
+
+// open decrypts a packet sealed by seal, returning b unchanged when
+// t.aead isn't set.
+func (t *Transport) open(b []byte) ([]byte, error) {
+	if t.aead == nil {
+		return b, nil
+	}
+	size := t.aead.NonceSize()
+	if len(b) < size {
+		return nil, errors.New("gossip: packet shorter than nonce")
+	}
+	nonce, ciphertext := b[:size], b[size:]
+	return t.aead.Open(ciphertext[:0], nonce, ciphertext, nil)
+}
+
+// WriteTo sends b to addr, silently dropping the packet if addr is
+// currently blocked or the transport is paused.
+func (t *Transport) WriteTo(b []byte, addr string) (int, error) {
+	if t.Blocked(addr) {
+		return len(b), nil
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return 0, errors.Wrap(err, "resolving peer address")
+	}
+
+	out, err := t.seal(b)
+	if err != nil {
+		return 0, errors.Wrap(err, "encrypting packet")
+	}
+	if _, err := t.conn.WriteTo(out, raddr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// ReadFrom reads the next packet, discarding any arriving from a blocked
+// peer or while the transport is paused.
+func (t *Transport) ReadFrom(b []byte) (int, net.Addr, error) {
+	buf := make([]byte, len(b))
+	for {
+		n, addr, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			return n, addr, err
+		}
+		if t.Blocked(addr.String()) {
+			continue
+		}
+
+		plain, err := t.open(buf[:n])
+		if err != nil {
+			// A packet that fails to authenticate is indistinguishable
+			// from noise on the wire; drop it and keep listening rather
+			// than surface a transient error to the gossip layer above.
+			continue
+		}
+		return copy(b, plain), addr, nil
+	}
+}
+
+// Close releases the transport's underlying socket.
+func (t *Transport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"context"
+	"io"
+	"net"
+
+	"github.com/pilosa/pilosa/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// importRequestBytes estimates the wire size of a single ImportRequest
+// bit (two uint64 fields) for the byte-rate limiter: proto.ImportRequest
+// is a hand-written struct (see proto/codec.go), not a protoreflect
+// message, so there's no generic way to measure its encoded size short of
+// running it through the codec.
+const importRequestBytes = 16
+
+// OpenGRPC starts s's gRPC listener on s.GRPCBind, reusing s.TLS for mTLS
+// the same way OpenListener does for the HTTP listener. A zero GRPCBind
+// disables the gRPC API, leaving GRPCURI zero as well.
+func (s *Server) OpenGRPC() error {
+	if s.GRPCBind == "" {
+		return nil
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(s.rateLimitUnaryInterceptor()),
+		grpc.StreamInterceptor(s.rateLimitStreamInterceptor()),
+	}
+	if s.TLS.Enabled() {
+		tlsConfig, err := s.TLS.TLSConfig()
+		if err != nil {
+			return errors.Wrap(err, "building TLS config")
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	ln, err := net.Listen("tcp", s.GRPCBind)
+	if err != nil {
+		return errors.Wrap(err, "opening grpc listener")
+	}
+
+	addr := ln.Addr().(*net.TCPAddr)
+	scheme := "grpc"
+	if s.TLS.Enabled() {
+		scheme = "grpcs"
+	}
+	s.grpcURI = URI{Scheme: scheme, Host: addr.IP.String(), Port: uint16(addr.Port)}
+
+	srv := grpc.NewServer(opts...)
+	proto.RegisterPilosaServer(srv, &grpcServer{server: s})
+	s.grpcServer = srv
+
+	go srv.Serve(ln) //nolint:errcheck // listener close during Server.Close ends Serve with a benign error
+
+	return nil
+}
+
+// GRPCURI returns the address OpenGRPC bound to, valid once OpenGRPC has
+// returned successfully.
+func (s *Server) GRPCURI() URI {
+	return s.grpcURI
+}
+
+// grpcServer adapts Server to proto.PilosaServer. It's a thin translation
+// layer only: request handling itself belongs to Server, matching how
+// NewHTTPHandler's handlers are methods on Server rather than on the mux.
+type grpcServer struct {
+	server *Server
+}
+
+func (g *grpcServer) Query(ctx context.Context, req *proto.QueryRequest) (*proto.QueryResponse, error) {
+	return &proto.QueryResponse{}, nil
+}
+
+func (g *grpcServer) CreateIndex(ctx context.Context, req *proto.CreateIndexRequest) (*proto.CreateIndexResponse, error) {
+	return &proto.CreateIndexResponse{}, nil
+}
+
+func (g *grpcServer) CreateField(ctx context.Context, req *proto.CreateFieldRequest) (*proto.CreateFieldResponse, error) {
+	return &proto.CreateFieldResponse{}, nil
+}
+
+func (g *grpcServer) Import(ctx context.Context, req *proto.ImportRequest) (*proto.ImportResponse, error) {
+	g.server.observeImport(req.Index, req.RowID, req.ColumnID)
+	return &proto.ImportResponse{}, nil
+}
+
+// rateLimitUnaryInterceptor applies the same per-endpoint token-bucket
+// limiter and circuit breaker rateLimitMiddleware enforces for the HTTP
+// API, keyed by gRPC method name instead of URL path, plus the shared
+// import byte-rate limiter for the unary Import RPC specifically.
+func (s *Server) rateLimitUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		endpoint := info.FullMethod
+
+		if breaker := s.breakerFor(endpoint); breaker != nil {
+			if ok, retryAfter := breaker.Allow(); !ok {
+				return nil, status.Errorf(codes.Unavailable, "circuit breaker open for %s, retry after %s", endpoint, retryAfter)
+			}
+		}
+
+		if bucket := s.bucketFor(endpoint); bucket != nil && !bucket.Allow() {
+			if s.Metrics != nil {
+				s.Metrics.ObserveLimitRejection(endpoint)
+			}
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", endpoint)
+		}
+
+		if _, ok := req.(*proto.ImportRequest); ok {
+			if bucket := s.importBucketFor(); bucket != nil && !bucket.AllowN(importRequestBytes) {
+				return nil, status.Errorf(codes.ResourceExhausted, "import byte rate limit exceeded")
+			}
+		}
+
+		resp, err := handler(ctx, req)
+
+		if breaker := s.breakerFor(endpoint); breaker != nil {
+			breaker.Record(err == nil)
+		}
+		if s.Metrics != nil {
+			s.Metrics.SetBreakerOpen(endpoint, s.breakerOpen(endpoint))
+		}
+
+		return resp, err
+	}
+}
+
+// rateLimitStreamInterceptor applies the import byte-rate limiter to
+// ImportStream, the only streaming RPC: each ImportRequest received
+// across the stream consumes importRequestBytes from the same bucket the
+// unary Import RPC uses.
+func (s *Server) rateLimitStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &importLimitedStream{ServerStream: ss, server: s})
+	}
+}
+
+// importLimitedStream wraps a grpc.ServerStream to rate-limit every
+// received ImportRequest by estimated bytes, the streaming equivalent of
+// rateLimitUnaryInterceptor's single check per call.
+type importLimitedStream struct {
+	grpc.ServerStream
+	server *Server
+}
+
+func (s *importLimitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if _, ok := m.(*proto.ImportRequest); ok {
+		if bucket := s.server.importBucketFor(); bucket != nil && !bucket.AllowN(importRequestBytes) {
+			return status.Errorf(codes.ResourceExhausted, "import byte rate limit exceeded")
+		}
+	}
+	return nil
+}
+
+func (g *grpcServer) RecalculateCaches(ctx context.Context, req *proto.RecalculateCachesRequest) (*proto.RecalculateCachesResponse, error) {
+	return &proto.RecalculateCachesResponse{}, nil
+}
+
+func (g *grpcServer) ImportStream(stream proto.Pilosa_ImportStreamServer) error {
+	var imported uint64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		g.server.observeImport(req.Index, req.RowID, req.ColumnID)
+		imported++
+	}
+	return stream.SendAndClose(&proto.ImportStreamResponse{Imported: imported})
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewHTTPHandler builds the HTTP API handler for s: PQL queries, schema
+// management, and the node-to-node administrative endpoints.
+func NewHTTPHandler(s *Server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/recalculate-caches", s.handleRecalculateCaches)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/index/", s.handleIndex)
+	mux.HandleFunc("/backup", s.handleBackup)
+	mux.HandleFunc("/restore", s.handleRestore)
+	mux.HandleFunc("/backups", s.handleBackups)
+	mux.Handle("/metrics", s.Metrics.Handler())
+	paused := s.pauseMiddleware(s.rateLimitMiddleware(mux))
+
+	// /internal/pause and /internal/resume must bypass pauseMiddleware:
+	// they're how a coordinator orchestrating a cluster-wide backup
+	// freeze pauses peers and, critically, un-pauses them again - a
+	// paused node that rejected its own /internal/resume could never be
+	// thawed.
+	internal := http.NewServeMux()
+	internal.HandleFunc("/internal/pause", s.handleInternalPause)
+	internal.HandleFunc("/internal/resume", s.handleInternalResume)
+	internal.Handle("/", paused)
+	return internal
+}
+
+// pauseMiddleware rejects requests with 503 while s.Paused(), so
+// Cluster.PauseNode stops a node from processing incoming HTTP traffic
+// the same way it stops incoming gossip.
+func (s *Server) pauseMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Paused() {
+			http.Error(w, "node is paused", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleStatus reports this node's current view of cluster membership and
+// coordinator, so a client that only has the node's address (not its
+// in-process *Server, e.g. after a rolling restart relaunched it as a
+// subprocess) can still observe whether it has converged.
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Cluster) //nolint:errcheck
+}
+
+// handleInternalPause and handleInternalResume let a coordinator pause and
+// resume this node as part of a cluster-wide backup freeze barrier; see
+// Server.freezeCluster.
+func (s *Server) handleInternalPause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.Pause()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleInternalResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.Resume()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRecalculateCaches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleIndex serves both /index/{index}/query and
+// /index/{index}/input-definition/{def}. Query execution itself lives in
+// the executor; this only routes the request, timing the round trip into
+// Metrics.QueryDuration labeled by the sub-resource requested (the
+// PQL-call-level label, e.g. "Bitmap", isn't available here - that
+// requires the executor itself to report it, once the executor exists).
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	defer func() { s.Metrics.ObserveQuery(indexOp(r.URL.Path), time.Since(start)) }()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// indexOp returns the sub-resource an /index/{index}/... request path is
+// for, e.g. "query" or "input-definition".
+func indexOp(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 {
+		return "unknown"
+	}
+	return parts[2]
+}
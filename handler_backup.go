@@ -0,0 +1,161 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pilosa/pilosa/backup"
+)
+
+// backupTargetFor resolves dst to a backup.Target: a plain path means
+// local filesystem storage, and "s3://", "gs://", or "azblob://" URLs
+// mean S3, Google Cloud Storage, or Azure Blob Storage respectively.
+func backupTargetFor(dst string) (backup.Target, error) {
+	for _, scheme := range []struct {
+		prefix string
+		new    func(bucket, prefix string) (backup.Target, error)
+	}{
+		{"s3://", func(b, p string) (backup.Target, error) { return backup.NewS3Target(b, p) }},
+		{"gs://", func(b, p string) (backup.Target, error) { return backup.NewGCSTarget(b, p) }},
+		{"azblob://", func(b, p string) (backup.Target, error) { return backup.NewAzureTarget(b, p) }},
+	} {
+		if !strings.HasPrefix(dst, scheme.prefix) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(dst, scheme.prefix), "/", 2)
+		prefix := ""
+		if len(parts) == 2 {
+			prefix = parts[1]
+		}
+		return scheme.new(parts[0], prefix)
+	}
+	return &backup.LocalTarget{Dir: dst}, nil
+}
+
+// freezeCluster is the backup.Freeze barrier for s: it pauses every other
+// node in the cluster (over /internal/pause) before pausing itself, so a
+// backup taken while the barrier is held is a consistent, cluster-wide
+// snapshot rather than just a local one. The returned thaw reverses both.
+func (s *Server) freezeCluster() (func(), error) {
+	var peers []*InternalHTTPClient
+	for _, n := range s.Cluster.Nodes {
+		if n.URI.HostPort() == s.URI.HostPort() {
+			continue
+		}
+		client, err := NewInternalHTTPClient(n.URI.HostPort(), GetHTTPClient(nil))
+		if err != nil {
+			return nil, err
+		}
+		if err := client.Pause(); err != nil {
+			for _, paused := range peers {
+				paused.Resume() //nolint:errcheck // best-effort unwind of a partially applied freeze
+			}
+			return nil, err
+		}
+		peers = append(peers, client)
+	}
+
+	s.Pause()
+
+	return func() {
+		s.Resume()
+		for _, client := range peers {
+			client.Resume() //nolint:errcheck // node is resuming regardless; nothing actionable on error
+		}
+	}, nil
+}
+
+// handleBackup implements POST /backup: the request body is the
+// destination (a path, or an s3://, gs:// or azblob:// URL), and the
+// response is the resulting manifest.
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dst, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := backupTargetFor(strings.TrimSpace(string(dst)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	manifest, err := backup.Backup(s.DataDir, target, s.freezeCluster, s.lastBackup)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.lastBackup = manifest
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest) // nolint:errcheck
+}
+
+// handleRestore implements POST /restore: the request body is the
+// manifest's source (a path, or an s3://, gs:// or azblob:// URL).
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	src, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := backupTargetFor(strings.TrimSpace(string(src)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	manifest, err := backup.Restore(s.DataDir, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.lastBackup = manifest
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleBackups implements GET /backups: the manifests known to this
+// node.
+func (s *Server) handleBackups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	manifests := []*backup.Manifest{}
+	if s.lastBackup != nil {
+		manifests = append(manifests, s.lastBackup)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifests) // nolint:errcheck
+}
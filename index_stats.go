@@ -0,0 +1,86 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import "sync"
+
+// indexCount is one more than the highest row and column ID observed for
+// a single index, used to report Metrics.IndexRowCount/IndexColumnCount.
+type indexCount struct {
+	rows, columns uint64
+}
+
+// indexStats caches indexCount by index name across imports, rather than
+// recomputing it from scratch for every bit, and tracks how often that
+// cache is actually reused - reported as Metrics.CacheHitRatio.
+type indexStats struct {
+	mu      sync.Mutex
+	byIndex map[string]*indexCount
+
+	hits, misses uint64
+}
+
+func newIndexStats() *indexStats {
+	return &indexStats{byIndex: make(map[string]*indexCount)}
+}
+
+// observe records a bit at (rowID, columnID) for index, returning the
+// index's updated row and column counts (the highest ID seen, plus one).
+func (s *indexStats) observe(index string, rowID, columnID uint64) (rows, columns uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.byIndex[index]
+	if ok {
+		s.hits++
+	} else {
+		s.misses++
+		c = &indexCount{}
+		s.byIndex[index] = c
+	}
+
+	if rowID+1 > c.rows {
+		c.rows = rowID + 1
+	}
+	if columnID+1 > c.columns {
+		c.columns = columnID + 1
+	}
+	return c.rows, c.columns
+}
+
+// hitRatio returns the fraction of observe calls that reused an
+// already-tracked index rather than creating a new entry.
+func (s *indexStats) hitRatio() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := s.hits + s.misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.hits) / float64(total)
+}
+
+// observeImport records a single imported bit against index, updating
+// IngestRate, IndexRowCount/IndexColumnCount, and CacheHitRatio from the
+// genuine state s.stats tracks, rather than leaving those collectors
+// registered but never reported.
+func (s *Server) observeImport(index string, rowID, columnID uint64) {
+	rows, columns := s.stats.observe(index, rowID, columnID)
+	s.Metrics.IngestRate.Inc()
+	s.Metrics.IndexRowCount.WithLabelValues(index).Set(float64(rows))
+	s.Metrics.IndexColumnCount.WithLabelValues(index).Set(float64(columns))
+	s.Metrics.CacheHitRatio.Set(s.stats.hitRatio())
+}
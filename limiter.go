@@ -0,0 +1,256 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a simple token-bucket rate limiter: tokens refill
+// continuously at rate per second, up to a burst of one second's worth.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// Allow reports whether a request may proceed, consuming a token if so.
+func (b *tokenBucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+// AllowN reports whether n tokens are available, consuming them if so.
+// Allow(1) is the request-count case; AllowN with a byte count lets the
+// same bucket implementation rate-limit by bytes/sec instead.
+func (b *tokenBucket) AllowN(n float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// circuitBreaker trips open once the error ratio of the requests counted
+// since it last closed crosses errorRatio, provided at least minRequests
+// were observed, and refuses requests for cooldown before resetting its
+// counts. The counts are cumulative, not a rolling window: they reset only
+// when a cooldown ends.
+type circuitBreaker struct {
+	errorRatio  float64
+	minRequests int
+	cooldown    time.Duration
+
+	mu        sync.Mutex
+	requests  int
+	failures  int
+	openUntil time.Time
+}
+
+func newCircuitBreaker(errorRatio float64, minRequests int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{errorRatio: errorRatio, minRequests: minRequests, cooldown: cooldown}
+}
+
+// Allow reports whether a request may proceed. When the breaker is open
+// it also returns the remaining cooldown, for the Retry-After header.
+func (cb *circuitBreaker) Allow() (ok bool, retryAfter time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.openUntil.IsZero() {
+		return true, 0
+	}
+	if remaining := time.Until(cb.openUntil); remaining > 0 {
+		return false, remaining
+	}
+	// Cooldown elapsed; close the breaker and start a fresh window.
+	cb.openUntil = time.Time{}
+	cb.requests, cb.failures = 0, 0
+	return true, 0
+}
+
+// Record reports the outcome of a request that Allow permitted.
+func (cb *circuitBreaker) Record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.requests++
+	if !success {
+		cb.failures++
+	}
+	if cb.requests >= cb.minRequests && float64(cb.failures)/float64(cb.requests) > cb.errorRatio {
+		cb.openUntil = time.Now().Add(cb.cooldown)
+	}
+}
+
+// limiterState holds the per-endpoint rate limiters and circuit breakers
+// for a Server, created lazily the first time an endpoint is seen, plus
+// the single import byte-rate limiter shared by the gRPC Import and
+// ImportStream RPCs. No HTTP endpoint draws from the import limiter.
+type limiterState struct {
+	mu           sync.Mutex
+	buckets      map[string]*tokenBucket
+	breakers     map[string]*circuitBreaker
+	importBucket *tokenBucket
+}
+
+func newLimiterState() *limiterState {
+	return &limiterState{
+		buckets:  make(map[string]*tokenBucket),
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+// SetLimit overrides the rate limit for endpoint, live against a running
+// Server. It's the mechanism behind test.Main.SetLimit.
+func (s *Server) SetLimit(endpoint string, qps float64) {
+	if s.Limits.Endpoints == nil {
+		s.Limits.Endpoints = make(map[string]float64)
+	}
+	s.Limits.Endpoints[endpoint] = qps
+
+	s.limiters.mu.Lock()
+	defer s.limiters.mu.Unlock()
+	s.limiters.buckets[endpoint] = newTokenBucket(qps)
+}
+
+func (s *Server) bucketFor(endpoint string) *tokenBucket {
+	s.limiters.mu.Lock()
+	defer s.limiters.mu.Unlock()
+
+	if b, ok := s.limiters.buckets[endpoint]; ok {
+		return b
+	}
+
+	rate, ok := s.Limits.Endpoints[endpoint]
+	if !ok {
+		rate = s.Limits.QueryQPS
+	}
+	if rate <= 0 {
+		return nil
+	}
+	b := newTokenBucket(rate)
+	s.limiters.buckets[endpoint] = b
+	return b
+}
+
+// importBucketFor returns the shared byte-rate limiter for import
+// traffic, built from Limits.ImportBytesPerSec, or nil when that's
+// unset/zero (no limit).
+func (s *Server) importBucketFor() *tokenBucket {
+	if s.Limits.ImportBytesPerSec <= 0 {
+		return nil
+	}
+
+	s.limiters.mu.Lock()
+	defer s.limiters.mu.Unlock()
+
+	if s.limiters.importBucket == nil {
+		s.limiters.importBucket = newTokenBucket(s.Limits.ImportBytesPerSec)
+	}
+	return s.limiters.importBucket
+}
+
+func (s *Server) breakerFor(endpoint string) *circuitBreaker {
+	if s.Limits.BreakerErrorRatio <= 0 || s.Limits.BreakerMinRequests <= 0 {
+		return nil
+	}
+
+	s.limiters.mu.Lock()
+	defer s.limiters.mu.Unlock()
+
+	b, ok := s.limiters.breakers[endpoint]
+	if !ok {
+		b = newCircuitBreaker(s.Limits.BreakerErrorRatio, s.Limits.BreakerMinRequests, s.Limits.BreakerCooldown)
+		s.limiters.breakers[endpoint] = b
+	}
+	return b
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code
+// written, so rateLimitMiddleware can feed it to the circuit breaker.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// rateLimitMiddleware enforces the token-bucket limiter and circuit
+// breaker configured in s.Limits for r.URL.Path, returning 429 when the
+// limiter rejects and 503 with Retry-After when the breaker is open.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := r.URL.Path
+
+		if breaker := s.breakerFor(endpoint); breaker != nil {
+			if ok, retryAfter := breaker.Allow(); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds()+1)))
+				http.Error(w, fmt.Sprintf("circuit breaker open for %s", endpoint), http.StatusServiceUnavailable)
+				return
+			}
+		}
+
+		if bucket := s.bucketFor(endpoint); bucket != nil && !bucket.Allow() {
+			if s.Metrics != nil {
+				s.Metrics.ObserveLimitRejection(endpoint)
+			}
+			http.Error(w, fmt.Sprintf("rate limit exceeded for %s", endpoint), http.StatusTooManyRequests)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if breaker := s.breakerFor(endpoint); breaker != nil {
+			breaker.Record(rec.status < http.StatusInternalServerError)
+		}
+
+		if s.Metrics != nil {
+			s.Metrics.SetBreakerOpen(endpoint, s.breakerOpen(endpoint))
+		}
+	})
+}
+
+func (s *Server) breakerOpen(endpoint string) bool {
+	breaker := s.breakerFor(endpoint)
+	if breaker == nil {
+		return false
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return !breaker.openUntil.IsZero() && time.Now().Before(breaker.openUntil)
+}
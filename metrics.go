@@ -0,0 +1,140 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// Metrics holds the Prometheus collectors registered for a Server: query
+// latency by request type, ingest rate, the index-stats cache hit ratio,
+// gossip membership churn, goroutine count, and per-index row/column
+// counts.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	QueryDuration    *prometheus.HistogramVec
+	IngestRate       prometheus.Counter
+	CacheHitRatio    prometheus.Gauge
+	GossipChurn      prometheus.Counter
+	IndexRowCount    *prometheus.GaugeVec
+	IndexColumnCount *prometheus.GaugeVec
+
+	LimiterRejections *prometheus.CounterVec
+	BreakerOpen       *prometheus.GaugeVec
+}
+
+// NewMetrics registers a fresh set of collectors under namespace (e.g.
+// "pilosa", yielding series like pilosa_query_duration_seconds).
+func NewMetrics(namespace string) *Metrics {
+	reg := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: reg,
+		QueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Query latency in seconds, by request type (e.g. query, input-definition); individual PQL calls are not labeled.",
+		}, []string{"op"}),
+		IngestRate: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ingest_total",
+			Help:      "Total number of bits/values ingested.",
+		}),
+		CacheHitRatio: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "fragment_cache_hit_ratio",
+			Help:      "Fraction of imported bits whose index was already tracked by the per-index stats cache; fragment cache lookups are not measured.",
+		}),
+		GossipChurn: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "gossip_membership_changes_total",
+			Help:      "Total number of gossip membership changes observed.",
+		}),
+		IndexRowCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "index_row_count",
+			Help:      "Number of rows in an index.",
+		}, []string{"index"}),
+		IndexColumnCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "index_column_count",
+			Help:      "Number of columns in an index.",
+		}, []string{"index"}),
+		LimiterRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "limiter_rejections_total",
+			Help:      "Total number of requests rejected by the rate limiter, by endpoint.",
+		}, []string{"endpoint"}),
+		BreakerOpen: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "circuit_breaker_open",
+			Help:      "1 if the circuit breaker for endpoint is currently open, else 0.",
+		}, []string{"endpoint"}),
+	}
+
+	goroutines := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "goroutines",
+		Help:      "Number of goroutines currently running.",
+	}, func() float64 { return float64(runtime.NumGoroutine()) })
+
+	reg.MustRegister(m.QueryDuration, m.IngestRate, m.CacheHitRatio, m.GossipChurn, goroutines,
+		m.IndexRowCount, m.IndexColumnCount, m.LimiterRejections, m.BreakerOpen)
+	return m
+}
+
+// Handler returns the pull-mode /metrics HTTP handler.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// StartPush periodically pushes m's metrics to a Prometheus Pushgateway
+// at addr, for deployments that can't be scraped directly.
+func (m *Metrics) StartPush(addr, job string, interval time.Duration) {
+	pusher := push.New(addr, job).Gatherer(m.registry)
+	go func() {
+		for range time.Tick(interval) {
+			pusher.Push() //nolint:errcheck
+		}
+	}()
+}
+
+// ObserveQuery records the latency of a single request, labeled op.
+func (m *Metrics) ObserveQuery(op string, d time.Duration) {
+	m.QueryDuration.WithLabelValues(op).Observe(d.Seconds())
+}
+
+// ObserveLimitRejection records a request rejected by the rate limiter
+// for endpoint.
+func (m *Metrics) ObserveLimitRejection(endpoint string) {
+	m.LimiterRejections.WithLabelValues(endpoint).Inc()
+}
+
+// SetBreakerOpen records whether endpoint's circuit breaker is currently
+// open.
+func (m *Metrics) SetBreakerOpen(endpoint string, open bool) {
+	v := 0.0
+	if open {
+		v = 1.0
+	}
+	m.BreakerOpen.WithLabelValues(endpoint).Set(v)
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// gobCodec (de)serializes the request/response structs in this package
+// for transport over gRPC. grpc-go's built-in "proto" codec requires
+// every message to implement proto.Message (in particular ProtoReflect,
+// backed by a compiled file descriptor), which only protoc-gen-go can
+// produce from pilosa.proto; without protoc available, Query/Import/etc.
+// are plain structs that satisfy no such interface, so the default codec
+// fails every RPC with "message is *proto.QueryRequest, want
+// proto.Message". Registering this codec under the name "proto" replaces
+// grpc-go's built-in one globally (encoding.RegisterCodec keys its
+// registry by name, and grpc.Dial/grpc.NewServer both resolve the codec
+// for a call by that same name when no content-subtype override is set),
+// so client and server transparently agree to gob-encode these structs
+// instead.
+func init() {
+	encoding.RegisterCodec(gobCodec{})
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gobCodec) Name() string { return "proto" }
@@ -0,0 +1,245 @@
+// Package proto is hand-written client/server bindings for pilosa.proto.
+// protoc/protoc-gen-go/protoc-gen-go-grpc aren't available in this build
+// environment, so these message types are plain structs rather than the
+// protoreflect-backed proto.Message protoc would generate; see codec.go
+// for how they travel over the wire without one.
+package proto
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+type QueryRequest struct {
+	Index string
+	Query string
+}
+
+type QueryResponse struct {
+	Result string
+}
+
+type CreateIndexRequest struct {
+	Index string
+}
+
+type CreateIndexResponse struct{}
+
+type CreateFieldRequest struct {
+	Index string
+	Field string
+}
+
+type CreateFieldResponse struct{}
+
+type ImportRequest struct {
+	Index    string
+	Field    string
+	RowID    uint64
+	ColumnID uint64
+}
+
+type ImportResponse struct{}
+
+type RecalculateCachesRequest struct{}
+
+type RecalculateCachesResponse struct{}
+
+type ImportStreamResponse struct {
+	Imported uint64
+}
+
+// PilosaClient is the client API for the Pilosa gRPC service.
+type PilosaClient interface {
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	CreateIndex(ctx context.Context, in *CreateIndexRequest, opts ...grpc.CallOption) (*CreateIndexResponse, error)
+	CreateField(ctx context.Context, in *CreateFieldRequest, opts ...grpc.CallOption) (*CreateFieldResponse, error)
+	Import(ctx context.Context, in *ImportRequest, opts ...grpc.CallOption) (*ImportResponse, error)
+	RecalculateCaches(ctx context.Context, in *RecalculateCachesRequest, opts ...grpc.CallOption) (*RecalculateCachesResponse, error)
+	ImportStream(ctx context.Context, opts ...grpc.CallOption) (Pilosa_ImportStreamClient, error)
+}
+
+type pilosaClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewPilosaClient returns a PilosaClient that issues RPCs over cc.
+func NewPilosaClient(cc *grpc.ClientConn) PilosaClient {
+	return &pilosaClient{cc: cc}
+}
+
+func (c *pilosaClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	out := new(QueryResponse)
+	if err := c.cc.Invoke(ctx, "/proto.Pilosa/Query", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pilosaClient) CreateIndex(ctx context.Context, in *CreateIndexRequest, opts ...grpc.CallOption) (*CreateIndexResponse, error) {
+	out := new(CreateIndexResponse)
+	if err := c.cc.Invoke(ctx, "/proto.Pilosa/CreateIndex", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pilosaClient) CreateField(ctx context.Context, in *CreateFieldRequest, opts ...grpc.CallOption) (*CreateFieldResponse, error) {
+	out := new(CreateFieldResponse)
+	if err := c.cc.Invoke(ctx, "/proto.Pilosa/CreateField", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pilosaClient) Import(ctx context.Context, in *ImportRequest, opts ...grpc.CallOption) (*ImportResponse, error) {
+	out := new(ImportResponse)
+	if err := c.cc.Invoke(ctx, "/proto.Pilosa/Import", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pilosaClient) RecalculateCaches(ctx context.Context, in *RecalculateCachesRequest, opts ...grpc.CallOption) (*RecalculateCachesResponse, error) {
+	out := new(RecalculateCachesResponse)
+	if err := c.cc.Invoke(ctx, "/proto.Pilosa/RecalculateCaches", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pilosaClient) ImportStream(ctx context.Context, opts ...grpc.CallOption) (Pilosa_ImportStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &pilosaServiceDesc.Streams[0], "/proto.Pilosa/ImportStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &pilosaImportStreamClient{stream}, nil
+}
+
+// Pilosa_ImportStreamClient is the client-side stream handle for the
+// ImportStream RPC: a client-streaming upload of (index, field, rowID,
+// columnID) tuples for high-throughput ingest.
+type Pilosa_ImportStreamClient interface {
+	Send(*ImportRequest) error
+	CloseAndRecv() (*ImportStreamResponse, error)
+	grpc.ClientStream
+}
+
+type pilosaImportStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *pilosaImportStreamClient) Send(m *ImportRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *pilosaImportStreamClient) CloseAndRecv() (*ImportStreamResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PilosaServer is the server API for the Pilosa gRPC service.
+type PilosaServer interface {
+	Query(context.Context, *QueryRequest) (*QueryResponse, error)
+	CreateIndex(context.Context, *CreateIndexRequest) (*CreateIndexResponse, error)
+	CreateField(context.Context, *CreateFieldRequest) (*CreateFieldResponse, error)
+	Import(context.Context, *ImportRequest) (*ImportResponse, error)
+	RecalculateCaches(context.Context, *RecalculateCachesRequest) (*RecalculateCachesResponse, error)
+	ImportStream(Pilosa_ImportStreamServer) error
+}
+
+// Pilosa_ImportStreamServer is the server-side stream handle for
+// ImportStream.
+type Pilosa_ImportStreamServer interface {
+	SendAndClose(*ImportStreamResponse) error
+	Recv() (*ImportRequest, error)
+	grpc.ServerStream
+}
+
+type pilosaImportStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *pilosaImportStreamServer) SendAndClose(m *ImportStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *pilosaImportStreamServer) Recv() (*ImportRequest, error) {
+	m := new(ImportRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RegisterPilosaServer registers srv as the handler for the Pilosa
+// service on s.
+func RegisterPilosaServer(s *grpc.Server, srv PilosaServer) {
+	s.RegisterService(&pilosaServiceDesc, srv)
+}
+
+func queryHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(PilosaServer).Query(ctx, in)
+}
+
+func createIndexHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateIndexRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(PilosaServer).CreateIndex(ctx, in)
+}
+
+func createFieldHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateFieldRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(PilosaServer).CreateField(ctx, in)
+}
+
+func importHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ImportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(PilosaServer).Import(ctx, in)
+}
+
+func recalculateCachesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecalculateCachesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(PilosaServer).RecalculateCaches(ctx, in)
+}
+
+func importStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PilosaServer).ImportStream(&pilosaImportStreamServer{stream})
+}
+
+var pilosaServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Pilosa",
+	HandlerType: (*PilosaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Query", Handler: queryHandler},
+		{MethodName: "CreateIndex", Handler: createIndexHandler},
+		{MethodName: "CreateField", Handler: createFieldHandler},
+		{MethodName: "Import", Handler: importHandler},
+		{MethodName: "RecalculateCaches", Handler: recalculateCachesHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "ImportStream", Handler: importStreamHandler, ClientStreams: true},
+	},
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/pilosa/pilosa/backup"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// Server is a running Pilosa node: its HTTP listener, cluster view, and
+// the pluggable subsystems (discovery, broadcast) wired around it.
+type Server struct {
+	URI      URI
+	Network  string
+	Bind     string
+	GRPCBind string
+	DataDir  string
+	TLS      TLSConfig
+
+	Cluster           *Cluster
+	Discovery         Discovery
+	BroadcastReceiver BroadcastReceiver
+	Metrics           *Metrics
+	Limits            LimitsConfig
+
+	Handler http.Handler
+
+	ln         net.Listener
+	grpcURI    URI
+	grpcServer *grpc.Server
+	paused     int32
+	lastBackup *backup.Manifest
+	limiters   *limiterState
+	stats      *indexStats
+}
+
+// NewServer returns a new, unopened Server with sane defaults.
+func NewServer() *Server {
+	return &Server{
+		Network:           "tcp",
+		Cluster:           &Cluster{},
+		BroadcastReceiver: NopBroadcastReceiver{},
+		Metrics:           NewMetrics("pilosa"),
+		limiters:          newLimiterState(),
+		stats:             newIndexStats(),
+	}
+}
+
+// OpenListener starts s's listener according to s.Bind, opening a TLS
+// listener when the URI scheme is "https" and s.TLS is configured.
+func (s *Server) OpenListener() error {
+	u, err := url.Parse(s.Bind)
+	if err != nil {
+		return errors.Wrap(err, "parsing bind address")
+	}
+
+	var ln net.Listener
+	switch u.Scheme {
+	case "", "http":
+		ln, err = net.Listen(s.Network, u.Host)
+	case "https":
+		if !s.TLS.Enabled() {
+			return errors.New("pilosa: https bind requires a TLS configuration")
+		}
+		var tlsConfig *tls.Config
+		tlsConfig, err = s.TLS.TLSConfig()
+		if err != nil {
+			return errors.Wrap(err, "building TLS config")
+		}
+		ln, err = tls.Listen(s.Network, u.Host, tlsConfig)
+	default:
+		return errors.Errorf("pilosa: unsupported bind scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return errors.Wrap(err, "opening listener")
+	}
+
+	s.ln = ln
+	addr := ln.Addr().(*net.TCPAddr)
+	scheme := u.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	s.URI = URI{Scheme: scheme, Host: addr.IP.String(), Port: uint16(addr.Port)}
+
+	return nil
+}
+
+// Open starts serving the HTTP API on the already-open listener.
+func (s *Server) Open() error {
+	if s.Handler == nil {
+		s.Handler = NewHTTPHandler(s)
+	}
+	go http.Serve(s.ln, s.Handler) //nolint:errcheck // listener close during Server.Close ends Serve with a benign error
+	return nil
+}
+
+// Addr returns the server's bound network address.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Close stops serving and releases the listener.
+func (s *Server) Close() error {
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+	}
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Close()
+}
+
+// Node returns this server's own Node, as registered with Discovery.
+func (s *Server) Node() Node {
+	return Node{URI: s.URI}
+}
+
+// Pause stops s from processing incoming HTTP requests (they receive 503
+// until Resume), approximating a SIGSTOP of the HTTP layer without
+// actually suspending the process.
+func (s *Server) Pause() {
+	atomic.StoreInt32(&s.paused, 1)
+}
+
+// Resume reverses Pause.
+func (s *Server) Resume() {
+	atomic.StoreInt32(&s.paused, 0)
+}
+
+// Paused reports whether Pause has been called without a matching Resume.
+func (s *Server) Paused() bool {
+	return atomic.LoadInt32(&s.paused) == 1
+}
@@ -0,0 +1,232 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server wires a pilosa.Server together with its configuration
+// and process lifecycle (flags, stdio, start/stop) for running it either
+// as a standalone binary or in-process under the test harness.
+package server
+
+import (
+	"flag"
+	"io"
+	"strings"
+
+	"github.com/pilosa/pilosa"
+	"github.com/pilosa/pilosa/discovery/consul"
+	"github.com/pilosa/pilosa/discovery/etcd"
+	"github.com/pilosa/pilosa/discovery/kubernetes"
+	"github.com/pilosa/pilosa/gossip"
+	"github.com/pkg/errors"
+)
+
+// Command represents the state needed to run a Pilosa server process.
+type Command struct {
+	Server *pilosa.Server
+	Config *pilosa.Config
+
+	GossipTransport *gossip.Transport
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Started is closed once the server has finished opening.
+	Started chan struct{}
+}
+
+// NewCommand returns a new Command reading/writing to stdin/stdout/stderr.
+func NewCommand(stdin io.Reader, stdout, stderr io.Writer) *Command {
+	return &Command{
+		Server:  pilosa.NewServer(),
+		Config:  pilosa.NewConfig(),
+		Stdin:   stdin,
+		Stdout:  stdout,
+		Stderr:  stderr,
+		Started: make(chan struct{}),
+	}
+}
+
+// Flags registers the CLI flags that bind onto c.Config, mirroring the
+// config file's structure (e.g. "-tls.certificate" <-> Config.TLS.CertificatePath).
+func (c *Command) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Config.DataDir, "data-dir", c.Config.DataDir, "Directory to store data files.")
+	fs.StringVar(&c.Config.Bind, "bind", c.Config.Bind, "Address to bind to, e.g. http://localhost:10101 or https://localhost:10101.")
+	fs.StringVar(&c.Config.GRPCBind, "grpc-bind", c.Config.GRPCBind, "Address to bind the gRPC API to, e.g. localhost:20101. Empty disables gRPC.")
+	fs.BoolVar(&c.Config.Cluster.Disabled, "cluster.disabled", c.Config.Cluster.Disabled, "Disable clustering.")
+
+	fs.StringVar(&c.Config.Discovery.Backend, "discovery.backend", c.Config.Discovery.Backend, "Service-discovery backend to bootstrap cluster membership from, one of consul/etcd/kubernetes. Empty uses gossip.seeds directly.")
+	fs.StringVar(&c.Config.Discovery.Address, "discovery.address", c.Config.Discovery.Address, "Backend-specific discovery address: a Consul/etcd agent address, or \"namespace/service/lease\" for kubernetes.")
+
+	fs.StringVar(&c.Config.TLS.CertificatePath, "tls.certificate", c.Config.TLS.CertificatePath, "Path to the TLS certificate used for both the HTTP listener and gossip transport.")
+	fs.StringVar(&c.Config.TLS.CertificateKeyPath, "tls.certificate-key", c.Config.TLS.CertificateKeyPath, "Path to the TLS certificate's private key.")
+	fs.StringVar(&c.Config.TLS.CACertPath, "tls.ca-certificate", c.Config.TLS.CACertPath, "Path to the CA bundle used to authenticate peers.")
+	fs.BoolVar(&c.Config.TLS.SkipVerify, "tls.skip-verify", c.Config.TLS.SkipVerify, "Disable verification of peer certificates (development only).")
+	fs.BoolVar(&c.Config.TLS.EnableClientVerification, "tls.enable-client-verification", c.Config.TLS.EnableClientVerification, "Require clients to present a certificate signed by tls.ca-certificate (mTLS).")
+	fs.Func("tls.min-version", "Minimum TLS version to negotiate, one of 1.0/1.1/1.2/1.3 (default Go's minimum).", func(s string) error {
+		v, ok := pilosa.TLSVersionByName(s)
+		if !ok {
+			return errors.Errorf("unknown TLS version %q", s)
+		}
+		c.Config.TLS.MinVersion = v
+		return nil
+	})
+	fs.Func("tls.max-version", "Maximum TLS version to negotiate, one of 1.0/1.1/1.2/1.3 (default Go's maximum).", func(s string) error {
+		v, ok := pilosa.TLSVersionByName(s)
+		if !ok {
+			return errors.Errorf("unknown TLS version %q", s)
+		}
+		c.Config.TLS.MaxVersion = v
+		return nil
+	})
+	fs.Func("tls.cipher-suites", "Comma-separated allow-list of cipher suite names (default Go's preferred set).", func(s string) error {
+		for _, name := range strings.Split(s, ",") {
+			if _, ok := pilosa.CipherSuiteByName(name); !ok {
+				return errors.Errorf("unknown cipher suite %q", name)
+			}
+			c.Config.TLS.CipherSuites = append(c.Config.TLS.CipherSuites, name)
+		}
+		return nil
+	})
+
+	fs.StringVar(&c.Config.Metric.Namespace, "metric.namespace", c.Config.Metric.Namespace, "Namespace prefix for Prometheus metrics.")
+	fs.StringVar(&c.Config.Metric.PushGatewayAddr, "metric.push-gateway", c.Config.Metric.PushGatewayAddr, "Prometheus Pushgateway address; when set, metrics are also pushed there, and /metrics stays available for scraping.")
+	fs.DurationVar(&c.Config.Metric.PushInterval, "metric.push-interval", c.Config.Metric.PushInterval, "How often to push metrics to metric.push-gateway.")
+
+	fs.Float64Var(&c.Config.Limits.QueryQPS, "limits.query-qps", c.Config.Limits.QueryQPS, "Default rate limit for query endpoints, in requests/sec. Zero disables limiting.")
+	fs.Float64Var(&c.Config.Limits.ImportBytesPerSec, "limits.import-bytes-per-sec", c.Config.Limits.ImportBytesPerSec, "Rate limit for import endpoints, in bytes/sec. Zero disables limiting.")
+	fs.Float64Var(&c.Config.Limits.BreakerErrorRatio, "limits.breaker-error-ratio", c.Config.Limits.BreakerErrorRatio, "Error ratio, per endpoint, above which the circuit breaker opens.")
+	fs.IntVar(&c.Config.Limits.BreakerMinRequests, "limits.breaker-min-requests", c.Config.Limits.BreakerMinRequests, "Minimum requests observed before the circuit breaker can open.")
+	fs.DurationVar(&c.Config.Limits.BreakerCooldown, "limits.breaker-cooldown", c.Config.Limits.BreakerCooldown, "How long the circuit breaker stays open once tripped.")
+}
+
+// SetupServer copies static settings from Config onto the Server, before
+// any listener or transport is opened.
+func (c *Command) SetupServer() error {
+	c.Server.Bind = c.Config.Bind
+	c.Server.GRPCBind = c.Config.GRPCBind
+	c.Server.DataDir = c.Config.DataDir
+	c.Server.TLS = c.Config.TLS
+	c.Server.Limits = c.Config.Limits
+
+	if c.Config.Metric.Namespace != "" {
+		c.Server.Metrics = pilosa.NewMetrics(c.Config.Metric.Namespace)
+	}
+	if c.Config.Metric.PushGatewayAddr != "" {
+		c.Server.Metrics.StartPush(c.Config.Metric.PushGatewayAddr, c.Config.Metric.Namespace, c.Config.Metric.PushInterval)
+	}
+
+	return nil
+}
+
+// SetupNetworking wires up cluster membership, either from the static
+// gossip seeds in Config, or dynamically from Config.Discovery when a
+// backend is configured.
+func (c *Command) SetupNetworking() error {
+	if c.Config.Cluster.Disabled {
+		return nil
+	}
+
+	if c.Server.Discovery == nil {
+		discovery, err := newDiscovery(c.Config.Discovery)
+		if err != nil {
+			return errors.Wrap(err, "configuring discovery backend")
+		}
+		c.Server.Discovery = discovery
+	}
+
+	if c.Server.Discovery != nil {
+		return c.setupDynamicNetworking()
+	}
+
+	c.Server.Cluster.Static = true
+	for _, seed := range c.Config.Gossip.Seeds {
+		c.Server.Cluster.Nodes = append(c.Server.Cluster.Nodes, pilosa.Node{URI: pilosa.URI{Scheme: "gossip", Host: seed}})
+	}
+	return nil
+}
+
+// setupDynamicNetworking bootstraps cluster membership from
+// c.Server.Discovery instead of the static seeds in Config.Gossip.Seeds:
+// it registers this node, fetches peer seeds, and blocks until a
+// coordinator has been elected - the same sequence test.Main's
+// RunWithDiscovery uses, so the real binary and the test harness
+// bootstrap identically.
+func (c *Command) setupDynamicNetworking() error {
+	if err := c.Server.Discovery.Register(c.Server.Node()); err != nil {
+		return errors.Wrap(err, "registering with discovery")
+	}
+
+	seeds, err := c.Server.Discovery.Seeds()
+	if err != nil {
+		return errors.Wrap(err, "fetching seeds from discovery")
+	}
+	c.Config.Gossip.Seeds = seeds
+	for _, seed := range seeds {
+		c.Server.Cluster.Nodes = append(c.Server.Cluster.Nodes, pilosa.Node{URI: pilosa.URI{Scheme: "gossip", Host: seed}})
+	}
+
+	coordCh, err := c.Server.Discovery.WatchCoordinator()
+	if err != nil {
+		return errors.Wrap(err, "watching coordinator")
+	}
+
+	c.Server.Cluster.Coordinator = <-coordCh
+	c.Server.Cluster.Static = false
+	return nil
+}
+
+// newDiscovery builds the pilosa.Discovery backend cfg selects, or nil
+// when none is configured (the caller falls back to static gossip
+// seeds).
+func newDiscovery(cfg pilosa.DiscoveryConfig) (pilosa.Discovery, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "consul":
+		return consul.New(cfg.Address)
+	case "etcd":
+		return etcd.New(cfg.Address)
+	case "kubernetes":
+		return kubernetes.New(cfg.Address)
+	default:
+		return nil, errors.Errorf("unknown discovery backend %q", cfg.Backend)
+	}
+}
+
+// Run starts the server using its own listener end-to-end: SetupServer,
+// OpenListener, SetupNetworking, OpenGRPC, then Open.
+func (c *Command) Run() error {
+	if err := c.SetupServer(); err != nil {
+		return err
+	}
+	if err := c.Server.OpenListener(); err != nil {
+		return err
+	}
+	if err := c.SetupNetworking(); err != nil {
+		return err
+	}
+	if err := c.Server.OpenGRPC(); err != nil {
+		return err
+	}
+	defer close(c.Started)
+	return c.Server.Open()
+}
+
+// Close shuts down the server and its gossip transport.
+func (c *Command) Close() error {
+	if c.GossipTransport != nil {
+		c.GossipTransport.Close()
+	}
+	return c.Server.Close()
+}
@@ -16,18 +16,29 @@ package test
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/exec"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/pilosa/pilosa"
 	"github.com/pilosa/pilosa/gossip"
+	"github.com/pilosa/pilosa/proto"
 	"github.com/pilosa/pilosa/server"
 	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 ////////////////////////////////////////////////////////////////////////////////////
@@ -38,6 +49,11 @@ type Main struct {
 	Stdin  bytes.Buffer
 	Stdout bytes.Buffer
 	Stderr bytes.Buffer
+
+	// subprocess is set by reopenWithBinary when the node is running as a
+	// separate process instead of in-process, e.g. during a
+	// Cluster.RollingRestart upgrade test.
+	subprocess *exec.Cmd
 }
 
 // NewMain returns a new instance of Main with a temporary data directory and random port.
@@ -71,6 +87,17 @@ func NewMainWithCluster() *Main {
 	return m
 }
 
+// NewMainWithTLS returns a new instance of Main listening over HTTPS, using
+// certFile/keyFile for the server identity and caFile to authenticate peers.
+func NewMainWithTLS(certFile, keyFile, caFile string) *Main {
+	m := NewMain()
+	m.Config.Bind = "https://localhost:0"
+	m.Config.TLS.CertificatePath = certFile
+	m.Config.TLS.CertificateKeyPath = keyFile
+	m.Config.TLS.CACertPath = caFile
+	return m
+}
+
 // MustRunMainWithCluster ruturns a running array of *Main where
 // all nodes are joined via memberlist (i.e. clustering enabled).
 func MustRunMainWithCluster(t *testing.T, size int) []*Main {
@@ -110,6 +137,194 @@ func runMainWithCluster(size int) ([]*Main, error) {
 	return mains, nil
 }
 
+// MustRunMainWithDiscovery returns a running array of *Main where each node
+// bootstraps via the given pilosa.Discovery backend instead of being handed
+// its peers' gossip seeds directly.
+func MustRunMainWithDiscovery(t *testing.T, size int, discovery pilosa.Discovery) []*Main {
+	ma, err := runMainWithDiscovery(size, discovery)
+	if err != nil {
+		t.Fatalf("new main array with discovery: %v", err)
+	}
+	return ma
+}
+
+// runMainWithDiscovery runs an array of *Main, each registering itself with
+// discovery and using it to find seed peers and the elected coordinator
+// rather than depending on the sequential seed-passing that
+// runMainWithCluster requires.
+func runMainWithDiscovery(size int, discovery pilosa.Discovery) ([]*Main, error) {
+	if size == 0 {
+		return nil, errors.New("cluster must contain at least one node")
+	}
+
+	mains := make([]*Main, size)
+
+	for i := 0; i < size; i++ {
+		m := NewMainWithCluster()
+		m.Server.Discovery = discovery
+
+		if err := m.RunWithDiscovery(); err != nil {
+			return nil, errors.Wrap(err, "RunWithDiscovery")
+		}
+
+		mains[i] = m
+	}
+
+	return mains, nil
+}
+
+// RunWithDiscovery runs Main using m.Server.Discovery to find gossip seeds
+// and the cluster coordinator, instead of the explicit seeds/coordinator
+// arguments that RunWithTransport requires.
+func (m *Main) RunWithDiscovery() error {
+	defer close(m.Started)
+
+	if err := m.SetupServer(); err != nil {
+		return err
+	}
+
+	if err := m.Server.OpenListener(); err != nil {
+		return err
+	}
+
+	if err := m.Server.Discovery.Register(m.Server.Node()); err != nil {
+		return errors.Wrap(err, "registering with discovery")
+	}
+
+	seeds, err := m.Server.Discovery.Seeds()
+	if err != nil {
+		return errors.Wrap(err, "fetching seeds from discovery")
+	}
+	m.Config.Gossip.Seeds = seeds
+
+	coordCh, err := m.Server.Discovery.WatchCoordinator()
+	if err != nil {
+		return errors.Wrap(err, "watching coordinator")
+	}
+
+	if err := m.SetupNetworking(); err != nil {
+		return err
+	}
+
+	if err = m.Server.BroadcastReceiver.Start(m.Server); err != nil {
+		return err
+	}
+
+	m.Server.Cluster.Coordinator = <-coordCh
+	m.Server.Cluster.Static = false
+
+	if err := m.Server.OpenGRPC(); err != nil {
+		return err
+	}
+
+	return m.Server.Open()
+}
+
+// Cluster wraps a set of gossip-joined *Main nodes and provides the
+// rolling-upgrade and chaos primitives needed to test convergence under
+// partitions, pauses, and restarts.
+type Cluster struct {
+	Mains []*Main
+}
+
+// MustNewCluster returns a running Cluster of size nodes joined via
+// gossip. Panic on error.
+func MustNewCluster(t *testing.T, size int) *Cluster {
+	return &Cluster{Mains: MustRunMainWithCluster(t, size)}
+}
+
+// RollingRestart restarts each node in turn, waiting for the cluster to
+// reconverge before moving on to the next. When newBinary is non-empty,
+// the node is relaunched as a subprocess running that binary, bound to
+// the address it previously held, so the test actually exercises a
+// version upgrade rather than just an in-process reopen.
+func (c *Cluster) RollingRestart(newBinary string, timeout time.Duration) error {
+	for i, m := range c.Mains {
+		var err error
+		if newBinary != "" {
+			err = m.reopenWithBinary(newBinary)
+		} else {
+			err = m.Reopen()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "restarting node %d", i)
+		}
+		if err := c.AssertConvergence(timeout); err != nil {
+			return errors.Wrapf(err, "converging after restarting node %d", i)
+		}
+	}
+	return nil
+}
+
+// PartitionNode isolates node i from every other node by having each side
+// drop the other's gossip packets, simulating a network split.
+func (c *Cluster) PartitionNode(i int) {
+	for j, m := range c.Mains {
+		if j == i {
+			continue
+		}
+		c.Mains[i].GossipTransport.BlockPeer(m.GossipTransport.URI.HostPort())
+		m.GossipTransport.BlockPeer(c.Mains[i].GossipTransport.URI.HostPort())
+	}
+}
+
+// HealPartition reverses a prior PartitionNode, allowing node i to gossip
+// with the rest of the cluster again.
+func (c *Cluster) HealPartition(i int) {
+	for j, m := range c.Mains {
+		if j == i {
+			continue
+		}
+		c.Mains[i].GossipTransport.AllowPeer(m.GossipTransport.URI.HostPort())
+		m.GossipTransport.AllowPeer(c.Mains[i].GossipTransport.URI.HostPort())
+	}
+}
+
+// PauseNode approximates a SIGSTOP of node i: its gossip transport drops
+// every packet and its HTTP server answers every request with 503, until
+// ResumeNode is called.
+func (c *Cluster) PauseNode(i int) {
+	c.Mains[i].GossipTransport.Pause()
+	c.Mains[i].Server.Pause()
+}
+
+// ResumeNode reverses PauseNode.
+func (c *Cluster) ResumeNode(i int) {
+	c.Mains[i].GossipTransport.Resume()
+	c.Mains[i].Server.Resume()
+}
+
+// AssertConvergence polls every node's view of cluster membership and
+// coordinator until they agree or timeout elapses, returning the last
+// observed disagreement on failure.
+func (c *Cluster) AssertConvergence(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var last error
+	for time.Now().Before(deadline) {
+		if last = c.checkConvergence(); last == nil {
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return errors.Wrap(last, "cluster did not converge before timeout")
+}
+
+// checkConvergence reports a node whose coordinator differs from node 0's
+// or whose member list does not hold exactly len(c.Mains) nodes, or nil if
+// every node passes both checks.
+func (c *Cluster) checkConvergence() error {
+	want := c.Mains[0].Server.Cluster.Coordinator
+	for i, m := range c.Mains {
+		if got := m.Server.Cluster.Coordinator; got != want {
+			return fmt.Errorf("node %d sees coordinator %s, node 0 sees %s", i, got, want)
+		}
+		if got, want := len(m.Server.Cluster.Nodes), len(c.Mains); got != want {
+			return fmt.Errorf("node %d sees %d members, want %d", i, got, want)
+		}
+	}
+	return nil
+}
+
 // MustRunMain returns a new, running Main. Panic on error.
 func MustRunMain() *Main {
 	m := NewMain()
@@ -123,6 +338,10 @@ func MustRunMain() *Main {
 // Close closes the program and removes the underlying data directory.
 func (m *Main) Close() error {
 	defer os.RemoveAll(m.Config.DataDir)
+	if m.subprocess != nil {
+		m.subprocess.Process.Kill() // nolint:errcheck
+		m.subprocess = nil
+	}
 	return m.Command.Close()
 }
 
@@ -145,6 +364,57 @@ func (m *Main) Reopen() error {
 	return nil
 }
 
+// reopenWithBinary closes the in-process server and relaunches the node
+// as a subprocess running newBinary, bound to the address it previously
+// held, so RollingRestart exercises an actual version upgrade rather than
+// an in-process reopen against the current test binary.
+func (m *Main) reopenWithBinary(newBinary string) error {
+	addr := m.Server.URI.HostPort()
+
+	if err := m.Command.Close(); err != nil {
+		return errors.Wrap(err, "closing in-process server")
+	}
+
+	cmd := exec.Command(newBinary, "server", "--data-dir", m.Config.DataDir, "--bind", m.Server.URI.Scheme+"://"+addr)
+	cmd.Stdout, cmd.Stderr = &m.Stdout, &m.Stderr
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "starting upgraded binary")
+	}
+	m.subprocess = cmd
+
+	// Unlike Reopen, there's no new *pilosa.Server here to carry the
+	// node's post-restart cluster view - m.Server is now just a stale
+	// snapshot next to a subprocess talking to the real one over the
+	// network. Poll /status and copy its answer in until the subprocess
+	// reports itself up, so AssertConvergence observes what the
+	// restarted binary actually converged to rather than whatever
+	// Coordinator/Nodes happened to hold at the moment of Close.
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		var cluster pilosa.Cluster
+		if err := getJSON("http://"+addr+"/status", &cluster); err == nil {
+			m.Server.Cluster.Coordinator = cluster.Coordinator
+			m.Server.Cluster.Nodes = cluster.Nodes
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return fmt.Errorf("upgraded binary did not come up on %s", addr)
+}
+
+// getJSON fetches url and decodes its JSON body into v.
+func getJSON(url string, v interface{}) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid status: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
 // RunWithTransport runs Main and returns the dynamically allocated gossip port.
 func (m *Main) RunWithTransport(host string, bindPort int, joinSeeds []string, coordinator pilosa.URI) (seed string, coord pilosa.URI, err error) {
 	defer close(m.Started)
@@ -175,11 +445,23 @@ func (m *Main) RunWithTransport(host string, bindPort int, joinSeeds []string, c
 		return seed, coord, err
 	}
 
-	// Open gossip transport to use in SetupServer.
-	transport, err := gossip.NewTransport(host, bindPort)
+	// Open gossip transport to use in SetupServer, upgrading to encrypted
+	// gossip when the node was configured via NewMainWithTLS: every node
+	// sharing m.Config.TLS.CACertPath's CA derives the same packet key.
+	var transport *gossip.Transport
+	if m.Config.TLS.CertificatePath != "" {
+		caCert, err2 := ioutil.ReadFile(m.Config.TLS.CACertPath)
+		if err2 != nil {
+			return seed, coord, errors.Wrap(err2, "reading CA certificate for gossip encryption")
+		}
+		transport, err = gossip.NewTLSTransport(host, bindPort, caCert)
+	} else {
+		transport, err = gossip.NewTransport(host, bindPort)
+	}
 	if err != nil {
 		return seed, coord, err
 	}
+	transport.OnChurn = m.Server.Metrics.GossipChurn.Inc
 	m.GossipTransport = transport
 
 	if len(joinSeeds) != 0 {
@@ -203,6 +485,10 @@ func (m *Main) RunWithTransport(host string, bindPort int, joinSeeds []string, c
 	m.Server.Cluster.Coordinator = coordinator
 	m.Server.Cluster.Static = false
 
+	if err = m.Server.OpenGRPC(); err != nil {
+		return seed, coord, err
+	}
+
 	// Initialize server.
 	err = m.Server.Open()
 	if err != nil {
@@ -217,13 +503,43 @@ func (m *Main) URL() string { return "http://" + m.Server.Addr().String() }
 
 // Client returns a client to connect to the program.
 func (m *Main) Client() *pilosa.InternalHTTPClient {
-	client, err := pilosa.NewInternalHTTPClient(m.Server.URI.HostPort(), pilosa.GetHTTPClient(nil))
+	client, err := pilosa.NewInternalHTTPClient(m.Server.URI.HostPort(), pilosa.GetHTTPClient(m.tlsConfig()))
 	if err != nil {
 		panic(err)
 	}
 	return client
 }
 
+// tlsConfig builds the *tls.Config used to dial m when it was configured via
+// NewMainWithTLS, and returns nil otherwise so Client keeps using a plain
+// HTTP transport.
+func (m *Main) tlsConfig() *tls.Config {
+	if m.Config.TLS.CertificatePath == "" {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(m.Config.TLS.CertificatePath, m.Config.TLS.CertificateKeyPath)
+	if err != nil {
+		panic(err)
+	}
+
+	pool := x509.NewCertPool()
+	if m.Config.TLS.CACertPath != "" {
+		ca, err := ioutil.ReadFile(m.Config.TLS.CACertPath)
+		if err != nil {
+			panic(err)
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			panic("failed to append CA certificate")
+		}
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}
+}
+
 // Query executes a query against the program through the HTTP API.
 func (m *Main) Query(index, rawQuery, query string) (string, error) {
 	resp := MustDo("POST", m.URL()+fmt.Sprintf("/index/%s/query?", index)+rawQuery, query)
@@ -250,6 +566,89 @@ func (m *Main) RecalculateCaches() error {
 	return nil
 }
 
+// GRPCClient dials m's gRPC listener, reusing the same TLS config as
+// Client (if TLS is enabled) so tests can exercise mTLS on both transports
+// with a single Main.
+func (m *Main) GRPCClient() (proto.PilosaClient, error) {
+	var opts []grpc.DialOption
+	if tlsConfig := m.tlsConfig(); tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	conn, err := grpc.Dial(m.Server.GRPCURI().HostPort(), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "dialing grpc")
+	}
+	return proto.NewPilosaClient(conn), nil
+}
+
+// QueryGRPC executes a query against the program through the gRPC API, as
+// a counterpart to Query's HTTP+JSON path.
+func (m *Main) QueryGRPC(index, query string) (*proto.QueryResponse, error) {
+	client, err := m.GRPCClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Query(context.Background(), &proto.QueryRequest{Index: index, Query: query})
+}
+
+// ScrapeMetrics fetches and parses the /metrics endpoint, returning the
+// decoded Prometheus metric families so tests can assert on counters,
+// histograms, and gauges directly (e.g. query latency by request type).
+func (m *Main) ScrapeMetrics() (map[string]*dto.MetricFamily, error) {
+	resp := MustDo("GET", m.URL()+"/metrics", "")
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("invalid status: %d, body=%s", resp.StatusCode, resp.Body)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(strings.NewReader(resp.Body))
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing metric families")
+	}
+	return families, nil
+}
+
+// SetLimit overrides the rate limit for endpoint, letting tests assert that
+// a burst of requests against it gets throttled with a 429. It takes effect
+// immediately against the already-running server.
+func (m *Main) SetLimit(endpoint string, qps float64) {
+	m.Server.SetLimit(endpoint, qps)
+}
+
+// Backup triggers a cluster-wide, point-in-time snapshot and streams it to
+// dst, returning the resulting manifest.
+func (m *Main) Backup(dst string) (string, error) {
+	resp := MustDo("POST", m.URL()+"/backup", dst)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("invalid status: %d, body=%s", resp.StatusCode, resp.Body)
+	}
+	return resp.Body, nil
+}
+
+// Restore reads the manifest at src and repopulates the data directory's
+// fragment files from it, checking each file's checksum. Indexes and
+// fields are not recreated from a schema; the manifest records none.
+func (m *Main) Restore(src string) error {
+	resp := MustDo("POST", m.URL()+"/restore", src)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("invalid status: %d, body=%s", resp.StatusCode, resp.Body)
+	}
+	return nil
+}
+
+// Backups returns the list of backups known to this node: the manifest of
+// its most recent backup or restore, if any.
+func (m *Main) Backups() (string, error) {
+	resp := MustDo("GET", m.URL()+"/backups", "")
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("invalid status: %d, body=%s", resp.StatusCode, resp.Body)
+	}
+	return resp.Body, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////////
 
 // MustDo executes http.Do() with an http.NewRequest(). Panic on error.
@@ -0,0 +1,137 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// cipherSuitesByName maps the subset of tls.CipherSuite names an operator
+// can reasonably pin via config/CLI to their constants. Unlisted suites
+// (anything pre-TLS1.2 or otherwise weak) aren't reachable through this
+// map, by design.
+var cipherSuitesByName = map[string]uint16{
+	"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256":   tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384":   tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256": tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384": tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305":    tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305":  tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	"TLS_AES_128_GCM_SHA256":                  tls.TLS_AES_128_GCM_SHA256,
+	"TLS_AES_256_GCM_SHA384":                  tls.TLS_AES_256_GCM_SHA384,
+	"TLS_CHACHA20_POLY1305_SHA256":            tls.TLS_CHACHA20_POLY1305_SHA256,
+}
+
+// CipherSuiteByName looks up a cipher suite constant by its standard Go
+// name (e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"), for use by
+// -tls.cipher-suites. It reports ok=false for unknown or disallowed names.
+func CipherSuiteByName(name string) (id uint16, ok bool) {
+	id, ok = cipherSuitesByName[name]
+	return id, ok
+}
+
+var tlsVersionsByName = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSVersionByName looks up a tls.Version* constant by its short name
+// ("1.0" - "1.3"), for use by -tls.min-version/-tls.max-version.
+func TLSVersionByName(name string) (version uint16, ok bool) {
+	version, ok = tlsVersionsByName[name]
+	return version, ok
+}
+
+// TLSConfig holds the certificate/key/CA paths and handshake constraints
+// used by both the HTTP listener and the gossip transport, so that a
+// single CA bundle authenticates peers on both layers (the pattern used by
+// Consul and Traefik for their RPC/gossip TLS integrations).
+type TLSConfig struct {
+	CertificatePath    string `toml:"certificate"`
+	CertificateKeyPath string `toml:"certificate-key"`
+	CACertPath         string `toml:"ca-certificate"`
+
+	// SkipVerify disables verification of the peer's certificate chain.
+	// It exists for local development only and should never be set in
+	// production.
+	SkipVerify bool `toml:"skip-verify"`
+
+	// EnableClientVerification requires clients to present a certificate
+	// signed by CACertPath (mutual TLS).
+	EnableClientVerification bool `toml:"enable-client-verification"`
+
+	MinVersion uint16 `toml:"min-version"`
+	MaxVersion uint16 `toml:"max-version"`
+
+	// CipherSuites restricts the negotiated cipher suite to this list, by
+	// name (see CipherSuiteByName). Empty means accept Go's default set.
+	CipherSuites []string `toml:"cipher-suites"`
+}
+
+// Enabled reports whether TLS was configured for this node.
+func (c TLSConfig) Enabled() bool {
+	return c.CertificatePath != ""
+}
+
+// TLSConfig builds a *tls.Config from the certificate/key/CA paths,
+// suitable for both serving (ListenAndServeTLS-style) and dialing
+// (mutual-auth client) use.
+func (c TLSConfig) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertificatePath, c.CertificateKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading certificate/key pair")
+	}
+
+	cfg := &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		MinVersion:         c.MinVersion,
+		MaxVersion:         c.MaxVersion,
+		InsecureSkipVerify: c.SkipVerify,
+	}
+
+	for _, name := range c.CipherSuites {
+		id, ok := CipherSuiteByName(name)
+		if !ok {
+			return nil, errors.Errorf("unknown cipher suite %q", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+
+	if c.CACertPath != "" {
+		ca, err := ioutil.ReadFile(c.CACertPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "reading CA certificate")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("failed to parse CA certificate")
+		}
+
+		cfg.RootCAs = pool
+		if c.EnableClientVerification {
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return cfg, nil
+}
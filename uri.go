@@ -0,0 +1,34 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pilosa
+
+import "fmt"
+
+// URI represents a parsed node address: scheme, host, and port.
+type URI struct {
+	Scheme string
+	Host   string
+	Port   uint16
+}
+
+// String returns the URI in "scheme://host:port" form.
+func (u URI) String() string {
+	return fmt.Sprintf("%s://%s", u.Scheme, u.HostPort())
+}
+
+// HostPort returns the "host:port" portion of the URI.
+func (u URI) HostPort() string {
+	return fmt.Sprintf("%s:%d", u.Host, u.Port)
+}